@@ -0,0 +1,127 @@
+package rxde
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// BatchConfig for delivering results in batches
+type BatchConfig struct {
+	Size    int      `json:"size"`    // maximum results per batch, 64 by default
+	Latency Duration `json:"latency"` // maximum time a result waits for its batch delivery, unbounded when zero
+	Buffer  int      `json:"buffer"`  // batches chan buffer size
+}
+
+// BatchStream of result batches parsed in its own goroutine
+type BatchStream struct {
+	batches chan []Result
+	summary Summary
+	err     error
+}
+
+// Batches returns the batches chan, closed when parsing ends
+func (st *BatchStream) Batches() (batches <-chan []Result) {
+	return st.batches
+}
+
+// Err returns why parsing ended as in ParseWithContext, once the batches chan is closed
+func (st *BatchStream) Err() (err error) {
+	return st.err
+}
+
+// Summary returns the parse summary, once the batches chan is closed
+func (st *BatchStream) Summary() (sum Summary) {
+	return st.summary
+}
+
+// ParseBuffered parses raw data in its own goroutine like ParseStream,
+// delivering the results through a chan with the given buffer size
+func (p *Parser) ParseBuffered(ctx context.Context, data io.Reader, buffer int, fields ...Field) (st *Stream) {
+	st = &Stream{results: make(chan Result, buffer)}
+
+	go func() {
+		st.summary, st.err = p.ParseWithContext(ctx, data, func(r Result) (ok bool) {
+			select {
+			case st.results <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}, fields...)
+		close(st.results)
+	}()
+
+	return st
+}
+
+// ParseBatch parses raw data in its own goroutine delivering the results in batches
+// of up to the configured size. A partial batch is delivered when its first result
+// waited for the configured latency and at the end of parsing.
+func (p *Parser) ParseBatch(ctx context.Context, data io.Reader, config BatchConfig, fields ...Field) (st *BatchStream) {
+	if config.Size <= 0 {
+		config.Size = 64
+	}
+
+	st = &BatchStream{batches: make(chan []Result, config.Buffer)}
+
+	var mtx sync.Mutex
+	var batch []Result
+	var timer *time.Timer
+	var gen int // batch generation, ignores stale timer fires
+
+	// send delivers the current batch, must be called with mtx held
+	send := func() (ok bool) {
+		if len(batch) == 0 {
+			return true
+		}
+		b := batch
+		batch = nil
+		gen++
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case st.batches <- b:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		st.summary, st.err = p.ParseWithContext(ctx, data, func(r Result) (ok bool) {
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			if batch == nil {
+				batch = make([]Result, 0, config.Size)
+				if config.Latency > 0 {
+					g := gen
+					timer = time.AfterFunc(time.Duration(config.Latency), func() {
+						mtx.Lock()
+						defer mtx.Unlock()
+						if g == gen {
+							send()
+						}
+					})
+				}
+			}
+
+			batch = append(batch, r)
+			if len(batch) < config.Size {
+				return true
+			}
+			return send()
+		}, fields...)
+
+		mtx.Lock()
+		send()
+		close(st.batches)
+		mtx.Unlock()
+	}()
+
+	return st
+}
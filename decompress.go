@@ -0,0 +1,40 @@
+package rxde
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/brunotm/rxde/internal/xz"
+	"github.com/brunotm/rxde/internal/zstd"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Decompress returns a reader decompressing r when its magic bytes identify a gzip,
+// bzip2, xz or zstd stream, including concatenated members, streams or frames.
+// Other inputs are returned as is.
+func Decompress(r io.Reader) (dr io.Reader, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(magicXz))
+
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, magicBzip2):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, magicXz):
+		return xz.NewReader(br)
+	case bytes.HasPrefix(magic, magicZstd):
+		return zstd.NewReader(br)
+	}
+
+	return br, nil
+}
@@ -0,0 +1,133 @@
+package rxde
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brunotm/rxde/expr"
+	"github.com/brunotm/rxde/rule"
+)
+
+var errDerivedCycle = errors.New("cyclic derived field dependency")
+
+// Derived field computed from an expression over other field values once a record is complete.
+// See the expr package for the expression syntax.
+type Derived struct {
+	Name string `json:"name"` // Field name
+	Expr string `json:"expr"` // Expression over other field values
+}
+
+type derived struct {
+	index int // field index
+	name  string
+	expr  *expr.Expr
+}
+
+// exprKind returns the expression kind for values produced by the rule
+func exprKind(r *rule.Rule) (k expr.Kind) {
+	switch r.Kind() {
+	case rule.KindNumber:
+		return expr.Number
+	case rule.KindString:
+		return expr.String
+	case rule.KindBool:
+		return expr.Bool
+	}
+	return expr.Any
+}
+
+// compileDerived parses, orders by dependency and type checks the derived fields.
+// Rules and sticky rules must be already created and their names present in names.
+func (p *Parser) compileDerived(config []Derived, names map[string]struct{}) (err error) {
+
+	p.fields = make([]expr.Field, 0, len(p.rules)+len(p.sticky)+len(config))
+	for i := range p.rules {
+		p.fields = append(p.fields, expr.Field{Name: p.rules[i].Config().Name, Kind: exprKind(p.rules[i])})
+	}
+	for i := range p.sticky {
+		p.fields = append(p.fields, expr.Field{Name: p.sticky[i].Config().Name, Kind: exprKind(p.sticky[i])})
+	}
+	base := len(p.fields)
+
+	if len(config) == 0 {
+		return nil
+	}
+
+	exprs := make([]*expr.Expr, len(config))
+	byName := make(map[string]int, len(config))
+
+	for i := range config {
+		if _, ok := names[config[i].Name]; ok || config[i].Name == "" {
+			return errRepeatedRuleName
+		}
+		names[config[i].Name] = struct{}{}
+		byName[config[i].Name] = i
+
+		if exprs[i], err = expr.Parse(config[i].Expr); err != nil {
+			return fmt.Errorf("derived %s: %s", config[i].Name, err)
+		}
+
+		p.fields = append(p.fields, expr.Field{Name: config[i].Name, Kind: expr.Invalid})
+	}
+
+	// order derived fields so dependencies are evaluated first
+	const visiting, visited = 1, 2
+	state := make([]int, len(config))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return errDerivedCycle
+		case visited:
+			return nil
+		}
+
+		state[i] = visiting
+		for _, name := range exprs[i].Names() {
+			if d, ok := byName[name]; ok {
+				if err := visit(d); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = visited
+
+		d := derived{index: base + i, name: config[i].Name, expr: exprs[i]}
+		kind, err := d.expr.Bind(p.fields)
+		if err != nil {
+			return fmt.Errorf("derived %s: %s", d.name, err)
+		}
+		p.fields[d.index].Kind = kind
+		p.derived = append(p.derived, d)
+
+		return nil
+	}
+
+	for i := range config {
+		if err = visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// derive evaluates the derived fields of a complete record appending them to its data.
+// Derived fields depending on missing values are omitted.
+func (p *Parser) derive(rec *record) {
+	for i := range p.derived {
+		d := &p.derived[i]
+
+		v, err := d.expr.Eval(rec.exprs)
+		if err != nil {
+			rec.exprs[d.index] = expr.Value{}
+			if err != expr.ErrMissing {
+				rec.Errors = append(rec.Errors, fmt.Errorf("derived %s: %s", d.name, err))
+			}
+			continue
+		}
+
+		rec.exprs[d.index] = v
+		rec.Data = appendJSON(rec.Data, d.name, appendValue(nil, v))
+	}
+}
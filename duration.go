@@ -0,0 +1,35 @@
+package rxde
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration encoded in JSON as a string like "1m30s".
+// Integer nanoseconds are also accepted when decoding.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() (data []byte, err error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string or integer nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	if len(data) == 0 || data[0] != '"' {
+		return json.Unmarshal(data, (*int64)(d))
+	}
+
+	var s string
+	if err = json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
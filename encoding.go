@@ -0,0 +1,311 @@
+package rxde
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var errEncoding = errors.New("unsupported encoding")
+
+// Encoding of the input, transcoded to UTF-8 before scanning
+type Encoding string
+
+// Input encodings. Without an encoding the input is scanned as UTF-8 as is.
+// Bytes undefined in an ISO-8859 part are decoded as U+FFFD.
+const (
+	EncodingUTF8        Encoding = "utf-8"        // UTF-8 dropping a leading BOM
+	EncodingUTF16       Encoding = "utf-16"       // UTF-16 with the byte order from the BOM, little endian without one
+	EncodingUTF16LE     Encoding = "utf-16le"     // UTF-16 little endian
+	EncodingUTF16BE     Encoding = "utf-16be"     // UTF-16 big endian
+	EncodingISO88591    Encoding = "iso-8859-1"   // Latin-1
+	EncodingISO88592    Encoding = "iso-8859-2"   // Latin-2, Central European
+	EncodingISO88593    Encoding = "iso-8859-3"   // Latin-3, South European
+	EncodingISO88594    Encoding = "iso-8859-4"   // Latin-4, North European
+	EncodingISO88595    Encoding = "iso-8859-5"   // Cyrillic
+	EncodingISO88596    Encoding = "iso-8859-6"   // Arabic
+	EncodingISO88597    Encoding = "iso-8859-7"   // Greek
+	EncodingISO88598    Encoding = "iso-8859-8"   // Hebrew
+	EncodingISO88599    Encoding = "iso-8859-9"   // Latin-5, Turkish
+	EncodingISO885910   Encoding = "iso-8859-10"  // Latin-6, Nordic
+	EncodingISO885911   Encoding = "iso-8859-11"  // Thai
+	EncodingISO885913   Encoding = "iso-8859-13"  // Latin-7, Baltic Rim
+	EncodingISO885914   Encoding = "iso-8859-14"  // Latin-8, Celtic
+	EncodingISO885915   Encoding = "iso-8859-15"  // Latin-9
+	EncodingISO885916   Encoding = "iso-8859-16"  // Latin-10, South-Eastern European
+	EncodingWindows1252 Encoding = "windows-1252" // Windows Western European
+)
+
+// decodeFunc appends the UTF-8 encoding of src to dst returning the number
+// of bytes consumed. Incomplete sequences are left unconsumed unless atEOF.
+type decodeFunc func(dst, src []byte, atEOF bool) (newDst []byte, n int)
+
+// validEncoding checks the encoding name
+func validEncoding(e Encoding) (err error) {
+	switch e = Encoding(strings.ToLower(string(e))); e {
+	case "", EncodingUTF8, EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		return nil
+	}
+
+	if _, ok := charmaps[e]; ok {
+		return nil
+	}
+	return errEncoding
+}
+
+// newDecoder returns a reader transcoding r from the encoding to UTF-8
+func newDecoder(r io.Reader, e Encoding) (dr io.Reader) {
+	var decode decodeFunc
+
+	switch Encoding(strings.ToLower(string(e))) {
+	case "":
+		return r
+
+	case EncodingUTF8:
+		br := bufio.NewReader(r)
+		if bom, _ := br.Peek(3); string(bom) == "\xef\xbb\xbf" {
+			br.Discard(3)
+		}
+		return br
+
+	case EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		br := bufio.NewReader(r)
+		bigEndian := Encoding(strings.ToLower(string(e))) == EncodingUTF16BE
+		switch bom, _ := br.Peek(2); string(bom) {
+		case "\xff\xfe":
+			bigEndian = false
+			br.Discard(2)
+		case "\xfe\xff":
+			bigEndian = true
+			br.Discard(2)
+		}
+		r = br
+		decode = func(dst, src []byte, atEOF bool) ([]byte, int) {
+			return decodeUTF16(dst, src, atEOF, bigEndian)
+		}
+
+	default:
+		charmap := charmaps[Encoding(strings.ToLower(string(e)))]
+		decode = func(dst, src []byte, atEOF bool) ([]byte, int) {
+			return decodeCharmap(dst, src, charmap)
+		}
+	}
+
+	return &decoder{r: r, decode: decode, src: make([]byte, 0, 4096)}
+}
+
+// decoder is a reader transcoding its input to UTF-8
+type decoder struct {
+	r      io.Reader
+	decode decodeFunc
+	src    []byte // undecoded input
+	buf    []byte // decoded output
+	pos    int    // read position in buf
+	err    error  // input error
+}
+
+func (d *decoder) Read(p []byte) (n int, err error) {
+	for d.pos == len(d.buf) {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		var m int
+		m, d.err = d.r.Read(d.src[len(d.src):cap(d.src)])
+		d.src = d.src[:len(d.src)+m]
+
+		var used int
+		d.buf, used = d.decode(d.buf[:0], d.src, d.err != nil)
+		d.pos = 0
+		d.src = d.src[:copy(d.src, d.src[used:])]
+	}
+
+	n = copy(p, d.buf[d.pos:])
+	d.pos += n
+	return n, nil
+}
+
+// decodeUTF16 decodes UTF-16 code units, replacing unpaired surrogates and
+// a trailing odd byte with U+FFFD
+func decodeUTF16(dst, src []byte, atEOF, bigEndian bool) (newDst []byte, n int) {
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(src[i])<<8 | rune(src[i+1])
+		}
+		return rune(src[i+1])<<8 | rune(src[i])
+	}
+
+	for n+1 < len(src) {
+		r := unit(n)
+
+		if utf16.IsSurrogate(r) && r < 0xdc00 {
+			if n+3 >= len(src) {
+				if !atEOF {
+					break
+				}
+				dst = utf8.AppendRune(dst, utf8.RuneError)
+				n += 2
+				continue
+			}
+
+			if r2 := unit(n + 2); r2 >= 0xdc00 && r2 <= 0xdfff {
+				dst = utf8.AppendRune(dst, utf16.DecodeRune(r, r2))
+				n += 4
+				continue
+			}
+			r = utf8.RuneError
+		} else if utf16.IsSurrogate(r) {
+			r = utf8.RuneError
+		}
+
+		dst = utf8.AppendRune(dst, r)
+		n += 2
+	}
+
+	if atEOF && n < len(src) {
+		dst = utf8.AppendRune(dst, utf8.RuneError)
+		n = len(src)
+	}
+
+	return dst, n
+}
+
+// decodeCharmap decodes a single byte charset. The charmap holds the code points
+// for bytes from 0x80, a nil charmap decodes Latin-1.
+func decodeCharmap(dst, src []byte, charmap *[128]rune) (newDst []byte, n int) {
+	for _, c := range src {
+		switch {
+		case c < utf8.RuneSelf:
+			dst = append(dst, c)
+		case charmap == nil:
+			dst = utf8.AppendRune(dst, rune(c))
+		default:
+			dst = utf8.AppendRune(dst, charmap[c-0x80])
+		}
+	}
+	return dst, len(src)
+}
+
+// latin1Charmap returns the Latin-1 charmap with the given replacements
+func latin1Charmap(replace map[byte]rune) (charmap *[128]rune) {
+	charmap = new([128]rune)
+	for i := range charmap {
+		charmap[i] = rune(0x80 + i)
+	}
+	for c, r := range replace {
+		charmap[c-0x80] = r
+	}
+	return charmap
+}
+
+// upperCharmap returns a charmap with the C1 controls and the given
+// code points for bytes from 0xa0
+func upperCharmap(upper string) (charmap *[128]rune) {
+	charmap = latin1Charmap(nil)
+	i := 0x20
+	for _, r := range upper {
+		charmap[i] = r
+		i++
+	}
+	return charmap
+}
+
+// charmaps of the single byte encodings, Latin-1 is decoded without one
+var charmaps = map[Encoding]*[128]rune{
+	EncodingISO88591:    nil,
+	EncodingISO88592:    iso88592,
+	EncodingISO88593:    iso88593,
+	EncodingISO88594:    iso88594,
+	EncodingISO88595:    iso88595,
+	EncodingISO88596:    iso88596,
+	EncodingISO88597:    iso88597,
+	EncodingISO88598:    iso88598,
+	EncodingISO88599:    iso88599,
+	EncodingISO885910:   iso885910,
+	EncodingISO885911:   iso885911,
+	EncodingISO885913:   iso885913,
+	EncodingISO885914:   iso885914,
+	EncodingISO885915:   iso885915,
+	EncodingISO885916:   iso885916,
+	EncodingWindows1252: windows1252,
+}
+
+var iso88592 = upperCharmap(
+	"\u00a0Ą˘Ł¤ĽŚ§¨ŠŞŤŹ\u00adŽŻ°ą˛ł´ľśˇ¸šşťź˝žż" +
+		"ŔÁÂĂÄĹĆÇČÉĘËĚÍÎĎĐŃŇÓÔŐÖ×ŘŮÚŰÜÝŢß" +
+		"ŕáâăäĺćçčéęëěíîďđńňóôőö÷řůúűüýţ˙")
+
+var iso88593 = upperCharmap(
+	"\u00a0Ħ˘£¤\ufffdĤ§¨İŞĞĴ\u00ad\ufffdŻ°ħ²³´µĥ·¸ışğĵ½\ufffdż" +
+		"ÀÁÂ\ufffdÄĊĈÇÈÉÊËÌÍÎÏ\ufffdÑÒÓÔĠÖ×ĜÙÚÛÜŬŜß" +
+		"àáâ\ufffdäċĉçèéêëìíîï\ufffdñòóôġö÷ĝùúûüŭŝ˙")
+
+var iso88594 = upperCharmap(
+	"\u00a0ĄĸŖ¤ĨĻ§¨ŠĒĢŦ\u00adŽ¯°ą˛ŗ´ĩļˇ¸šēģŧŊžŋ" +
+		"ĀÁÂÃÄÅÆĮČÉĘËĖÍÎĪĐŅŌĶÔÕÖ×ØŲÚÛÜŨŪß" +
+		"āáâãäåæįčéęëėíîīđņōķôõö÷øųúûüũū˙")
+
+var iso88595 = upperCharmap(
+	"\u00a0ЁЂЃЄЅІЇЈЉЊЋЌ\u00adЎЏАБВГДЕЖЗИЙКЛМНОП" +
+		"РСТУФХЦЧШЩЪЫЬЭЮЯабвгдежзийклмноп" +
+		"рстуфхцчшщъыьэюя№ёђѓєѕіїјљњћќ§ўџ")
+
+var iso88596 = upperCharmap(
+	"\u00a0\ufffd\ufffd\ufffd¤\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd،\u00ad\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd؛\ufffd\ufffd\ufffd؟" +
+		"\ufffdءآأؤإئابةتثجحخدذرزسشصضطظعغ\ufffd\ufffd\ufffd\ufffd\ufffd" +
+		"ـفقكلمنهوىي\u064b\u064c\u064d\u064e\u064f\u0650\u0651\u0652\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd")
+
+var iso88597 = upperCharmap(
+	"\u00a0‘’£€₯¦§¨©ͺ«¬\u00ad\ufffd―°±²³΄΅Ά·ΈΉΊ»Ό½ΎΏ" +
+		"ΐΑΒΓΔΕΖΗΘΙΚΛΜΝΞΟΠΡ\ufffdΣΤΥΦΧΨΩΪΫάέήί" +
+		"ΰαβγδεζηθικλμνξοπρςστυφχψωϊϋόύώ\ufffd")
+
+var iso88598 = upperCharmap(
+	"\u00a0\ufffd¢£¤¥¦§¨©×«¬\u00ad®¯°±²³´µ¶·¸¹÷»¼½¾\ufffd" +
+		"\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd\ufffd‗" +
+		"אבגדהוזחטיךכלםמןנסעףפץצקרשת\ufffd\ufffd\u200e\u200f\ufffd")
+
+var iso88599 = upperCharmap(
+	"\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯°±²³´µ¶·¸¹º»¼½¾¿" +
+		"ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏĞÑÒÓÔÕÖ×ØÙÚÛÜİŞß" +
+		"àáâãäåæçèéêëìíîïğñòóôõö÷øùúûüışÿ")
+
+var iso885910 = upperCharmap(
+	"\u00a0ĄĒĢĪĨĶ§ĻĐŠŦŽ\u00adŪŊ°ąēģīĩķ·ļđšŧž―ūŋ" +
+		"ĀÁÂÃÄÅÆĮČÉĘËĖÍÎÏÐŅŌÓÔÕÖŨØŲÚÛÜÝÞß" +
+		"āáâãäåæįčéęëėíîïðņōóôõöũøųúûüýþĸ")
+
+var iso885911 = upperCharmap(
+	"\u00a0กขฃคฅฆงจฉชซฌญฎฏฐฑฒณดตถทธนบปผฝพฟ" +
+		"ภมยรฤลฦวศษสหฬอฮฯะ\u0e31าำ\u0e34\u0e35\u0e36\u0e37\u0e38\u0e39\u0e3a\ufffd\ufffd\ufffd\ufffd฿" +
+		"เแโใไๅๆ\u0e47\u0e48\u0e49\u0e4a\u0e4b\u0e4c\u0e4d\u0e4e๏๐๑๒๓๔๕๖๗๘๙๚๛\ufffd\ufffd\ufffd\ufffd")
+
+var iso885913 = upperCharmap(
+	"\u00a0”¢£¤„¦§Ø©Ŗ«¬\u00ad®Æ°±²³“µ¶·ø¹ŗ»¼½¾æ" +
+		"ĄĮĀĆÄÅĘĒČÉŹĖĢĶĪĻŠŃŅÓŌÕÖ×ŲŁŚŪÜŻŽß" +
+		"ąįāćäåęēčéźėģķīļšńņóōõö÷ųłśūüżž’")
+
+var iso885914 = upperCharmap(
+	"\u00a0Ḃḃ£ĊċḊ§Ẁ©ẂḋỲ\u00ad®ŸḞḟĠġṀṁ¶ṖẁṗẃṠỳẄẅṡ" +
+		"ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏŴÑÒÓÔÕÖṪØÙÚÛÜÝŶß" +
+		"àáâãäåæçèéêëìíîïŵñòóôõöṫøùúûüýŷÿ")
+
+var iso885916 = upperCharmap(
+	"\u00a0ĄąŁ€„Š§š©Ș«Ź\u00adźŻ°±ČłŽ”¶·žčș»ŒœŸż" +
+		"ÀÁÂĂÄĆÆÇÈÉÊËÌÍÎÏĐŃÒÓÔŐÖŚŰÙÚÛÜĘȚß" +
+		"àáâăäćæçèéêëìíîïđńòóôőöśűùúûüęțÿ")
+
+var iso885915 = latin1Charmap(map[byte]rune{
+	0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž', 0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+})
+
+// windows1252 replaces the C1 controls, undefined bytes are decoded as in Latin-1
+var windows1252 = latin1Charmap(map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+})
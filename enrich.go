@@ -0,0 +1,119 @@
+package rxde
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Field is a named value added to every result of a parse call
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// encoded field
+type field struct {
+	name  string
+	value []byte
+}
+
+// encodeFields encodes the static fields sorted by name, checking
+// for names already in use
+func encodeFields(fields map[string]interface{}, names map[string]struct{}) (encoded []field, err error) {
+	for name := range fields {
+		if _, ok := names[name]; ok || name == "" {
+			return nil, errRepeatedRuleName
+		}
+		names[name] = struct{}{}
+
+		value, err := json.Marshal(fields[name])
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, field{name: name, value: value})
+	}
+
+	sort.Slice(encoded, func(i, j int) bool { return encoded[i].name < encoded[j].name })
+	return encoded, nil
+}
+
+// encodeCallFields encodes the per call fields, checking for repeated
+// names and names in use by the parser
+func (p *Parser) encodeCallFields(fields []Field) (encoded []field, err error) {
+	for i := range fields {
+		if _, ok := p.names[fields[i].Name]; ok || fields[i].Name == "" {
+			return nil, errRepeatedRuleName
+		}
+
+		for j := range encoded {
+			if encoded[j].name == fields[i].Name {
+				return nil, errRepeatedRuleName
+			}
+		}
+
+		value, err := json.Marshal(fields[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, field{name: fields[i].Name, value: value})
+	}
+
+	return encoded, nil
+}
+
+// metaNames adds the configured metadata field names to names
+func metaNames(config Config, names map[string]struct{}) (err error) {
+	for _, name := range []string{config.LineField, config.OffsetField, config.TimeField, config.StateField} {
+		if name == "" {
+			continue
+		}
+		if _, ok := names[name]; ok {
+			return errRepeatedRuleName
+		}
+		names[name] = struct{}{}
+	}
+	return nil
+}
+
+// enrich appends the static, per call and metadata fields to the record data
+func (p *Parser) enrich(rec *record, s *session) {
+	for i := range p.static {
+		rec.Data = appendJSON(rec.Data, p.static[i].name, p.static[i].value)
+	}
+
+	for i := range s.fields {
+		rec.Data = appendJSON(rec.Data, s.fields[i].name, s.fields[i].value)
+	}
+
+	if p.config.LineField != "" {
+		v := make([]byte, 0, 24)
+		v = append(v, '[')
+		v = strconv.AppendInt(v, rec.first, 10)
+		v = append(v, ',')
+		v = strconv.AppendInt(v, rec.last, 10)
+		v = append(v, ']')
+		rec.Data = appendJSON(rec.Data, p.config.LineField, v)
+	}
+
+	if p.config.OffsetField != "" {
+		rec.Data = appendJSON(rec.Data, p.config.OffsetField, strconv.AppendInt(nil, rec.offset, 10))
+	}
+
+	if p.config.TimeField != "" {
+		v := make([]byte, 0, len(time.RFC3339Nano)+2)
+		v = append(v, '"')
+		v = p.now().AppendFormat(v, time.RFC3339Nano)
+		v = append(v, '"')
+		rec.Data = appendJSON(rec.Data, p.config.TimeField, v)
+	}
+}
+
+// now returns the current time from the parser reference clock
+func (p *Parser) now() (t time.Time) {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
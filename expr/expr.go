@@ -0,0 +1,131 @@
+// Package expr implements a small expression language evaluated over record field values.
+//
+// Expressions support number, string and bool literals, field references,
+// arithmetic (+ - * / %), comparisons (== != < <= > >=), logical operators (&& || !),
+// conditionals (cond ? a : b) and the functions min, max, abs, round, floor, ceil and if.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Kind of a value
+type Kind uint8
+
+// Value kinds
+const (
+	Invalid Kind = iota // missing value
+	Number
+	String
+	Bool
+	Any // kind is only known at evaluation
+)
+
+var (
+	// ErrMissing is returned when evaluating an expression that references a missing field value
+	ErrMissing = errors.New("missing value")
+
+	errDivByZero = errors.New("division by zero")
+	errNotFinite = errors.New("result is not a finite number")
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Any:
+		return "any"
+	}
+	return "invalid"
+}
+
+// Value is a typed value
+type Value struct {
+	Kind Kind
+	Num  float64
+	Str  string
+	Bool bool
+}
+
+// Field declares the name and value kind of a field that can be referenced in expressions
+type Field struct {
+	Name string
+	Kind Kind
+}
+
+// Expr is a parsed expression. An Expr is safe for concurrent evaluation once bound.
+type Expr struct {
+	src   string
+	root  node
+	names []string
+	kind  Kind
+}
+
+// Parse parses the expression source
+func Parse(src string) (e *Expr, err error) {
+	p := &parser{lex: lexer{src: src}}
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+
+	e = &Expr{src: src}
+	if e.root, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+
+	e.names = p.names
+	return e, nil
+}
+
+// String returns the expression source
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Names returns the field names referenced by the expression
+func (e *Expr) Names() (names []string) {
+	return e.names
+}
+
+// Kind returns the kind of the expression result, valid after Bind
+func (e *Expr) Kind() (kind Kind) {
+	return e.kind
+}
+
+// Bind resolves field references to the index of the field with the same name,
+// and type checks the expression returning the kind of its result
+func (e *Expr) Bind(fields []Field) (kind Kind, err error) {
+	if e.kind, err = e.root.bind(fields); err != nil {
+		return Invalid, fmt.Errorf("expr %q: %s", e.src, err)
+	}
+	return e.kind, nil
+}
+
+// Eval evaluates the expression with the given field values indexed as the fields used in Bind.
+// Returns ErrMissing if a required field value is Invalid.
+func (e *Expr) Eval(values []Value) (v Value, err error) {
+	if v, err = e.root.eval(values); err != nil {
+		return v, err
+	}
+
+	if v.Kind == Number && (math.IsNaN(v.Num) || math.IsInf(v.Num, 0)) {
+		return v, errNotFinite
+	}
+
+	return v, nil
+}
+
+// Truth returns true only if the value is the bool true
+func (v Value) Truth() bool {
+	return v.Kind == Bool && v.Bool
+}
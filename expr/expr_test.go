@@ -0,0 +1,124 @@
+package expr
+
+import (
+	"testing"
+)
+
+var fields = []Field{
+	{Name: "total", Kind: Number},
+	{Name: "used", Kind: Number},
+	{Name: "state", Kind: String},
+	{Name: "up", Kind: Bool},
+	{Name: "missing", Kind: Number},
+	{Name: "any", Kind: Any},
+}
+
+var values = []Value{
+	{Kind: Number, Num: 200},
+	{Kind: Number, Num: 50},
+	{Kind: String, Str: "D"},
+	{Kind: Bool, Bool: true},
+	{},
+	{Kind: Number, Num: 3},
+}
+
+var cases = []struct {
+	src    string
+	expect Value
+}{
+	{`used / total * 100`, Value{Kind: Number, Num: 25}},
+	{`total - used`, Value{Kind: Number, Num: 150}},
+	{`-used + 2 * (total - 10) % 7`, Value{Kind: Number, Num: -50 + 2*float64(190%7)}},
+	{`min(total, used, 10)`, Value{Kind: Number, Num: 10}},
+	{`max(total, used)`, Value{Kind: Number, Num: 200}},
+	{`abs(used - total)`, Value{Kind: Number, Num: 150}},
+	{`round(10 / 4)`, Value{Kind: Number, Num: 3}},
+	{`state == "D" && up`, Value{Kind: Bool, Bool: true}},
+	{`state != 'D' || !up`, Value{Kind: Bool, Bool: false}},
+	{`used > total ? "over" : "ok"`, Value{Kind: String, Str: "ok"}},
+	{`if(up, total, 0)`, Value{Kind: Number, Num: 200}},
+	{`state + "-" + state`, Value{Kind: String, Str: "D-D"}},
+	{`up || missing > 0`, Value{Kind: Bool, Bool: true}},
+	{`any * 2`, Value{Kind: Number, Num: 6}},
+	{`1.5e2`, Value{Kind: Number, Num: 150}},
+}
+
+func TestEval(t *testing.T) {
+	for _, testCase := range cases {
+		t.Run(testCase.src, func(t *testing.T) {
+			e, err := Parse(testCase.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kind, err := e.Bind(fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := e.Eval(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v != testCase.expect {
+				t.Fatal("not equal: ", v, testCase.expect)
+			}
+
+			if kind != Any && kind != v.Kind {
+				t.Fatal("kind mismatch: ", kind, v.Kind)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	e, err := Parse(`missing * 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Bind(fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Eval(values); err != ErrMissing {
+		t.Fatal("expected missing value, got: ", err)
+	}
+
+	e, err = Parse(`used / (total - 200)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Bind(fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Eval(values); err != errDivByZero {
+		t.Fatal("expected division by zero, got: ", err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	invalid := []string{
+		`used +`,
+		`(used`,
+		`used $ total`,
+		`"unterminated`,
+		`unknown_func(used)`,
+		`max()`,
+		`unknown_field + 1`,
+		`state * 2`,
+		`used == state`,
+		`up ? 1 : "a"`,
+		`!used`,
+		`used && up`,
+	}
+
+	for _, src := range invalid {
+		e, err := Parse(src)
+		if err == nil {
+			_, err = e.Bind(fields)
+		}
+		if err == nil {
+			t.Fatal("accepted invalid expression: ", src)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+)
+
+type node interface {
+	// bind resolves field references and returns the node result kind
+	bind(fields []Field) (kind Kind, err error)
+	// eval evaluates the node with the given field values
+	eval(values []Value) (v Value, err error)
+}
+
+type function struct {
+	min, max int // number of arguments, max 0 for variadic
+	unary    func(x float64) float64
+	reduce   func(acc, x float64) float64
+}
+
+var functions = map[string]function{
+	"min":   {min: 1, reduce: math.Min},
+	"max":   {min: 1, reduce: math.Max},
+	"abs":   {min: 1, max: 1, unary: math.Abs},
+	"round": {min: 1, max: 1, unary: math.Round},
+	"floor": {min: 1, max: 1, unary: math.Floor},
+	"ceil":  {min: 1, max: 1, unary: math.Ceil},
+	"if":    {min: 3, max: 3},
+}
+
+// compatible returns true if a value of kind k can be used where want is expected
+func compatible(k, want Kind) bool {
+	return k == want || k == Any
+}
+
+func operandError(op string, k Kind) error {
+	return fmt.Errorf("invalid %s operand for %s", k, op)
+}
+
+type literalNode struct {
+	v Value
+}
+
+func (n *literalNode) bind(fields []Field) (kind Kind, err error) {
+	return n.v.Kind, nil
+}
+
+func (n *literalNode) eval(values []Value) (v Value, err error) {
+	return n.v, nil
+}
+
+type fieldNode struct {
+	name  string
+	index int
+}
+
+func (n *fieldNode) bind(fields []Field) (kind Kind, err error) {
+	for i := range fields {
+		if fields[i].Name == n.name {
+			n.index = i
+			return fields[i].Kind, nil
+		}
+	}
+	return Invalid, fmt.Errorf("unknown field %q", n.name)
+}
+
+func (n *fieldNode) eval(values []Value) (v Value, err error) {
+	v = values[n.index]
+	if v.Kind == Invalid {
+		return v, ErrMissing
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+func (n *unaryNode) bind(fields []Field) (kind Kind, err error) {
+	if kind, err = n.x.bind(fields); err != nil {
+		return Invalid, err
+	}
+
+	want := Number
+	if n.op == "!" {
+		want = Bool
+	}
+
+	if !compatible(kind, want) {
+		return Invalid, operandError(n.op, kind)
+	}
+	return want, nil
+}
+
+func (n *unaryNode) eval(values []Value) (v Value, err error) {
+	if v, err = n.x.eval(values); err != nil {
+		return v, err
+	}
+
+	switch {
+	case n.op == "-" && v.Kind == Number:
+		v.Num = -v.Num
+	case n.op == "!" && v.Kind == Bool:
+		v.Bool = !v.Bool
+	default:
+		return v, operandError(n.op, v.Kind)
+	}
+	return v, nil
+}
+
+type binaryNode struct {
+	op   string
+	l, r node
+}
+
+func (n *binaryNode) bind(fields []Field) (kind Kind, err error) {
+	lk, err := n.l.bind(fields)
+	if err != nil {
+		return Invalid, err
+	}
+
+	rk, err := n.r.bind(fields)
+	if err != nil {
+		return Invalid, err
+	}
+
+	// the known kind of both operands
+	k := lk
+	if k == Any {
+		k = rk
+	}
+
+	if !compatible(lk, k) || !compatible(rk, k) {
+		return Invalid, fmt.Errorf("mismatched %s and %s operands for %s", lk, rk, n.op)
+	}
+
+	switch n.op {
+	case "&&", "||":
+		if !compatible(k, Bool) {
+			return Invalid, operandError(n.op, k)
+		}
+		return Bool, nil
+
+	case "==", "!=":
+		return Bool, nil
+
+	case "<", "<=", ">", ">=":
+		if k == Bool {
+			return Invalid, operandError(n.op, k)
+		}
+		return Bool, nil
+
+	case "+":
+		if k == Bool {
+			return Invalid, operandError(n.op, k)
+		}
+		return k, nil
+	}
+
+	if !compatible(k, Number) {
+		return Invalid, operandError(n.op, k)
+	}
+	return Number, nil
+}
+
+func (n *binaryNode) eval(values []Value) (v Value, err error) {
+	l, err := n.l.eval(values)
+	if err != nil {
+		return v, err
+	}
+
+	// short circuit logical operators
+	switch n.op {
+	case "&&", "||":
+		if l.Kind != Bool {
+			return v, operandError(n.op, l.Kind)
+		}
+		if (n.op == "&&") != l.Bool {
+			return l, nil
+		}
+		r, err := n.r.eval(values)
+		if err != nil {
+			return v, err
+		}
+		if r.Kind != Bool {
+			return v, operandError(n.op, r.Kind)
+		}
+		return r, nil
+	}
+
+	r, err := n.r.eval(values)
+	if err != nil {
+		return v, err
+	}
+
+	if l.Kind != r.Kind {
+		return v, fmt.Errorf("mismatched %s and %s operands for %s", l.Kind, r.Kind, n.op)
+	}
+
+	switch n.op {
+	case "==":
+		return Value{Kind: Bool, Bool: l == r}, nil
+	case "!=":
+		return Value{Kind: Bool, Bool: l != r}, nil
+	}
+
+	switch l.Kind {
+	case String:
+		switch n.op {
+		case "<":
+			return Value{Kind: Bool, Bool: l.Str < r.Str}, nil
+		case "<=":
+			return Value{Kind: Bool, Bool: l.Str <= r.Str}, nil
+		case ">":
+			return Value{Kind: Bool, Bool: l.Str > r.Str}, nil
+		case ">=":
+			return Value{Kind: Bool, Bool: l.Str >= r.Str}, nil
+		case "+":
+			return Value{Kind: String, Str: l.Str + r.Str}, nil
+		}
+
+	case Number:
+		switch n.op {
+		case "<":
+			return Value{Kind: Bool, Bool: l.Num < r.Num}, nil
+		case "<=":
+			return Value{Kind: Bool, Bool: l.Num <= r.Num}, nil
+		case ">":
+			return Value{Kind: Bool, Bool: l.Num > r.Num}, nil
+		case ">=":
+			return Value{Kind: Bool, Bool: l.Num >= r.Num}, nil
+		case "+":
+			return Value{Kind: Number, Num: l.Num + r.Num}, nil
+		case "-":
+			return Value{Kind: Number, Num: l.Num - r.Num}, nil
+		case "*":
+			return Value{Kind: Number, Num: l.Num * r.Num}, nil
+		case "/":
+			if r.Num == 0 {
+				return v, errDivByZero
+			}
+			return Value{Kind: Number, Num: l.Num / r.Num}, nil
+		case "%":
+			if r.Num == 0 {
+				return v, errDivByZero
+			}
+			return Value{Kind: Number, Num: math.Mod(l.Num, r.Num)}, nil
+		}
+	}
+
+	return v, operandError(n.op, l.Kind)
+}
+
+type condNode struct {
+	cond, a, b node
+}
+
+func (n *condNode) bind(fields []Field) (kind Kind, err error) {
+	ck, err := n.cond.bind(fields)
+	if err != nil {
+		return Invalid, err
+	}
+
+	if !compatible(ck, Bool) {
+		return Invalid, fmt.Errorf("invalid %s condition", ck)
+	}
+
+	ak, err := n.a.bind(fields)
+	if err != nil {
+		return Invalid, err
+	}
+
+	bk, err := n.b.bind(fields)
+	if err != nil {
+		return Invalid, err
+	}
+
+	switch {
+	case ak == bk:
+		return ak, nil
+	case ak == Any || bk == Any:
+		return Any, nil
+	}
+
+	return Invalid, fmt.Errorf("mismatched %s and %s conditional results", ak, bk)
+}
+
+func (n *condNode) eval(values []Value) (v Value, err error) {
+	c, err := n.cond.eval(values)
+	if err != nil {
+		return v, err
+	}
+
+	if c.Kind != Bool {
+		return v, fmt.Errorf("invalid %s condition", c.Kind)
+	}
+
+	if c.Bool {
+		return n.a.eval(values)
+	}
+	return n.b.eval(values)
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) bind(fields []Field) (kind Kind, err error) {
+	for i := range n.args {
+		k, err := n.args[i].bind(fields)
+		if err != nil {
+			return Invalid, err
+		}
+		if !compatible(k, Number) {
+			return Invalid, fmt.Errorf("invalid %s argument for %s", k, n.name)
+		}
+	}
+	return Number, nil
+}
+
+func (n *callNode) eval(values []Value) (v Value, err error) {
+	if v, err = n.args[0].eval(values); err != nil {
+		return v, err
+	}
+
+	if v.Kind != Number {
+		return v, fmt.Errorf("invalid %s argument for %s", v.Kind, n.name)
+	}
+
+	if n.fn.unary != nil {
+		v.Num = n.fn.unary(v.Num)
+		return v, nil
+	}
+
+	for i := 1; i < len(n.args); i++ {
+		a, err := n.args[i].eval(values)
+		if err != nil {
+			return v, err
+		}
+		if a.Kind != Number {
+			return v, fmt.Errorf("invalid %s argument for %s", a.Kind, n.name)
+		}
+		v.Num = n.fn.reduce(v.Num, a.Num)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,326 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokKind uint8
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+// two character operators, checked before single character ones
+var operators2 = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+const operators1 = "+-*/%<>!?:(),"
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func isIdent(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(!first && (c == '.' || (c >= '0' && c <= '9')))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) next() (t token, err error) {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t' || l.src[l.pos] == '\n' || l.src[l.pos] == '\r') {
+		l.pos++
+	}
+
+	t.pos = l.pos
+	if l.pos == len(l.src) {
+		return t, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		// exponent
+		if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+			l.pos++
+			if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+				l.pos++
+			}
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		}
+		t.kind, t.text = tokNumber, l.src[start:l.pos]
+
+	case isIdent(c, true):
+		for l.pos < len(l.src) && isIdent(l.src[l.pos], false) {
+			l.pos++
+		}
+		t.kind, t.text = tokIdent, l.src[start:l.pos]
+
+	case c == '"' || c == '\'':
+		l.pos++
+		var b strings.Builder
+		for {
+			if l.pos == len(l.src) {
+				return t, fmt.Errorf("unterminated string at %d", start)
+			}
+			ch := l.src[l.pos]
+			l.pos++
+			if ch == c {
+				break
+			}
+			if ch == '\\' && l.pos < len(l.src) {
+				ch = l.src[l.pos]
+				l.pos++
+				switch ch {
+				case 'n':
+					ch = '\n'
+				case 't':
+					ch = '\t'
+				case 'r':
+					ch = '\r'
+				}
+			}
+			b.WriteByte(ch)
+		}
+		t.kind, t.text = tokString, b.String()
+
+	default:
+		for _, op := range operators2 {
+			if strings.HasPrefix(l.src[l.pos:], op) {
+				l.pos += 2
+				t.kind, t.text = tokOp, op
+				return t, nil
+			}
+		}
+		if strings.IndexByte(operators1, c) < 0 {
+			return t, fmt.Errorf("unexpected character %q at %d", c, start)
+		}
+		l.pos++
+		t.kind, t.text = tokOp, l.src[start:l.pos]
+	}
+
+	return t, nil
+}
+
+type parser struct {
+	lex   lexer
+	tok   token
+	names []string
+}
+
+func (p *parser) next() (err error) {
+	p.tok, err = p.lex.next()
+	return err
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) expect(op string) (err error) {
+	if !p.isOp(op) {
+		if p.tok.kind == tokEOF {
+			return p.errorf("expected %q, got end of expression", op)
+		}
+		return p.errorf("expected %q, got %q", op, p.tok.text)
+	}
+	return p.next()
+}
+
+// parseExpr parses: or ['?' expr ':' expr]
+func (p *parser) parseExpr() (n node, err error) {
+	if n, err = p.parseBinary(0); err != nil {
+		return nil, err
+	}
+
+	if !p.isOp("?") {
+		return n, nil
+	}
+
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+
+	c := &condNode{cond: n}
+	if c.a, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if err = p.expect(":"); err != nil {
+		return nil, err
+	}
+	if c.b, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// binary operators by increasing precedence
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (n node, err error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+
+	if n, err = p.parseBinary(level + 1); err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokOp {
+		op := ""
+		for _, o := range precedence[level] {
+			if p.tok.text == o {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return n, nil
+		}
+
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		n = &binaryNode{op: op, l: n, r: r}
+	}
+
+	return n, nil
+}
+
+func (p *parser) parseUnary() (n node, err error) {
+	if p.isOp("-") || p.isOp("!") {
+		op := p.tok.text
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (n node, err error) {
+	t := p.tok
+
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", t.text)
+		}
+		n = &literalNode{v: Value{Kind: Number, Num: f}}
+
+	case tokString:
+		n = &literalNode{v: Value{Kind: String, Str: t.text}}
+
+	case tokIdent:
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case p.isOp("("):
+			return p.parseCall(t)
+		case t.text == "true" || t.text == "false":
+			return &literalNode{v: Value{Kind: Bool, Bool: t.text == "true"}}, nil
+		}
+
+		p.names = append(p.names, t.text)
+		return &fieldNode{name: t.text}, nil
+
+	case tokOp:
+		if t.text != "(" {
+			return nil, p.errorf("unexpected %q", t.text)
+		}
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		if n, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+
+	default:
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	return n, p.next()
+}
+
+func (p *parser) parseCall(name token) (n node, err error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+
+	// skip (
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+
+	c := &callNode{name: name.text, fn: fn}
+	for !p.isOp(")") {
+		if len(c.args) > 0 {
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		a, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, a)
+	}
+
+	if len(c.args) < fn.min || (fn.max > 0 && len(c.args) > fn.max) {
+		return nil, fmt.Errorf("invalid number of arguments for %s at %d", name.text, name.pos)
+	}
+
+	if name.text == "if" {
+		return &condNode{cond: c.args[0], a: c.args[1], b: c.args[2]}, p.next()
+	}
+
+	return c, p.next()
+}
@@ -0,0 +1,58 @@
+package rxde
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brunotm/rxde/expr"
+)
+
+var errFilterKind = errors.New("filter expression must evaluate to bool")
+
+// compileFilter parses and type checks the filter expression against
+// the rule and derived fields
+func (p *Parser) compileFilter(filter string) (err error) {
+	if filter == "" {
+		return nil
+	}
+
+	if p.filter, err = expr.Parse(filter); err != nil {
+		return fmt.Errorf("filter: %s", err)
+	}
+
+	kind, err := p.filter.Bind(p.fields)
+	if err != nil {
+		return fmt.Errorf("filter: %s", err)
+	}
+
+	if kind != expr.Bool && kind != expr.Any {
+		return errFilterKind
+	}
+
+	return nil
+}
+
+// match evaluates the filter against a complete record with decoded values.
+// Records missing values required by the filter don't match, while records
+// failing evaluation for other reasons match with the error appended.
+func (p *Parser) match(rec *record) (ok bool) {
+	if p.filter == nil {
+		return true
+	}
+
+	v, err := p.filter.Eval(rec.exprs)
+	switch {
+	case err == expr.ErrMissing:
+		return false
+	case err != nil:
+		rec.Errors = append(rec.Errors, fmt.Errorf("filter: %s", err))
+		return true
+	}
+
+	if v.Kind != expr.Bool {
+		rec.Errors = append(rec.Errors, errFilterKind)
+		return true
+	}
+
+	return v.Bool
+}
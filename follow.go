@@ -0,0 +1,288 @@
+package rxde
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var errFollowPath = errors.New("empty follow path")
+
+// FollowConfig for following a growing file
+type FollowConfig struct {
+	Path       string   `json:"path"`       // file to follow
+	Checkpoint string   `json:"checkpoint"` // file persisting the parsed offset for resuming after a restart
+	Interval   Duration `json:"interval"`   // minimum interval between checkpoint writes, 1s by default
+	Poll       Duration `json:"poll"`       // interval for checking for new data and rotation, 250ms by default
+	FromStart  bool     `json:"from_start"` // read from the start instead of the end when there is no checkpoint
+}
+
+// checkpointer is implemented by sources persisting the offset of the delivered records.
+// The offset is the number of input bytes consumed by the scanner.
+type checkpointer interface {
+	checkpoint(offset int64) (err error)
+}
+
+// checkpoint is the checkpoint file content
+type checkpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+// Follower is a reader following a growing file like tail -F. It waits for new data
+// at the end of the file, reopens the file when it's renamed and reads from the start
+// when it's truncated. Read returns io.EOF only after Close.
+//
+// When used as the ParseWith input without decompression or transcoding, the offset
+// of the delivered records is persisted to the checkpoint file, if configured, and
+// parsing resumes after them when the follower is created again.
+type Follower struct {
+	config FollowConfig
+	mtx    sync.Mutex
+	file   *os.File
+	offset int64 // read offset in the current file
+	base   int64 // scanner offset of the start of the current file
+	saved  int64 // last saved scanner offset
+	dirty  bool  // checkpoint pending write
+	last   time.Time
+	wait   chan struct{}
+	closed chan struct{}
+}
+
+// NewFollower opens the file for following, resuming from the checkpoint when present
+func NewFollower(config FollowConfig) (f *Follower, err error) {
+	if config.Path == "" {
+		return nil, errFollowPath
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = Duration(time.Second)
+	}
+
+	if config.Poll <= 0 {
+		config.Poll = Duration(250 * time.Millisecond)
+	}
+
+	f = &Follower{config: config, wait: make(chan struct{}, 1), closed: make(chan struct{})}
+	if f.file, err = os.Open(config.Path); err != nil {
+		return nil, err
+	}
+
+	info, err := f.file.Stat()
+	if err != nil {
+		f.file.Close()
+		return nil, err
+	}
+
+	switch cp, ok := f.loadCheckpoint(); {
+	case ok && cp.Offset <= info.Size():
+		f.offset = cp.Offset
+	case ok || config.FromStart:
+		// truncated since the checkpoint
+		f.offset = 0
+	default:
+		f.offset = info.Size()
+	}
+
+	if _, err = f.file.Seek(f.offset, io.SeekStart); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+
+	// scanner offsets start at the resume offset
+	f.base = -f.offset
+	return f, nil
+}
+
+// loadCheckpoint reads the checkpoint for the followed path
+func (f *Follower) loadCheckpoint() (cp checkpoint, ok bool) {
+	if f.config.Checkpoint == "" {
+		return cp, false
+	}
+
+	data, err := os.ReadFile(f.config.Checkpoint)
+	if err != nil || json.Unmarshal(data, &cp) != nil || cp.Path != f.config.Path {
+		return cp, false
+	}
+
+	return cp, true
+}
+
+// Read reads from the followed file, waiting for new data at its end
+func (f *Follower) Read(p []byte) (n int, err error) {
+	for {
+		f.mtx.Lock()
+		if f.isClosed() {
+			f.mtx.Unlock()
+			return 0, io.EOF
+		}
+		n, err = f.file.Read(p)
+		f.offset += int64(n)
+		f.mtx.Unlock()
+
+		if n > 0 {
+			return n, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		rotated, err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+
+		if rotated {
+			continue
+		}
+
+		// signal waiting for new data
+		select {
+		case f.wait <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-f.closed:
+			return 0, io.EOF
+		case <-time.After(time.Duration(f.config.Poll)):
+		}
+	}
+}
+
+// rotate checks at the end of the file if it was renamed or truncated,
+// switching to the start of the new or truncated file
+func (f *Follower) rotate() (rotated bool, err error) {
+	info, err := os.Stat(f.config.Path)
+	if err != nil {
+		// renamed and not yet created again
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.isClosed() {
+		return false, nil
+	}
+
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case !os.SameFile(info, current):
+		file, err := os.Open(f.config.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		f.file.Close()
+		f.file = file
+
+	case info.Size() < f.offset:
+		if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+
+	default:
+		return false, nil
+	}
+
+	f.base += f.offset
+	f.offset = 0
+	return true, nil
+}
+
+func (f *Follower) isClosed() bool {
+	select {
+	case <-f.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// waiting returns the channel signaled when the follower waits for new data
+func (f *Follower) waiting() (wait <-chan struct{}) {
+	return f.wait
+}
+
+// checkpoint records the scanner offset of the delivered records,
+// writing the checkpoint file at most once per interval
+func (f *Follower) checkpoint(offset int64) (err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	// offsets before the current file can't be resumed from
+	if f.config.Checkpoint == "" || offset <= f.saved || offset < f.base {
+		return nil
+	}
+
+	f.saved = offset
+	f.dirty = true
+
+	if time.Since(f.last) < time.Duration(f.config.Interval) {
+		return nil
+	}
+
+	return f.save()
+}
+
+// save writes the checkpoint file atomically
+func (f *Follower) save() (err error) {
+	// nothing was delivered from the current file
+	offset := f.saved - f.base
+	if offset < 0 {
+		offset = 0
+	}
+
+	data, err := json.Marshal(checkpoint{Path: f.config.Path, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	tmp := f.config.Checkpoint + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, f.config.Checkpoint); err != nil {
+		return err
+	}
+
+	f.dirty = false
+	f.last = time.Now()
+	return nil
+}
+
+// Close writes any pending checkpoint and closes the file, ending pending reads with io.EOF
+func (f *Follower) Close() (err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.isClosed() {
+		return nil
+	}
+	close(f.closed)
+
+	if f.dirty {
+		err = f.save()
+	}
+
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,394 @@
+package xz
+
+import (
+	"encoding/binary"
+)
+
+const (
+	probInit     = 1 << 10 // initial probability of a bit being 0
+	states       = 12
+	posStatesMax = 1 << 4
+	endMarker    = 0xFFFFFFFF
+)
+
+// rangeDecoder decodes bits from a range coded LZMA chunk held in memory
+type rangeDecoder struct {
+	in      []byte
+	pos     int
+	rng     uint32
+	code    uint32
+	overrun bool // read past the end of the chunk
+}
+
+// init starts decoding the chunk, returning false if it has an invalid header
+func (rc *rangeDecoder) init(in []byte) (ok bool) {
+	if len(in) < 5 || in[0] != 0 {
+		return false
+	}
+	rc.in = in
+	rc.pos = 5
+	rc.rng = 0xFFFFFFFF
+	rc.code = binary.BigEndian.Uint32(in[1:5])
+	rc.overrun = false
+	return rc.code != rc.rng
+}
+
+// finished returns true if the chunk was fully and correctly consumed
+func (rc *rangeDecoder) finished() (ok bool) {
+	return !rc.overrun && rc.pos == len(rc.in) && rc.code == 0
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng >= 1<<24 {
+		return
+	}
+	rc.rng <<= 8
+	rc.code <<= 8
+	if rc.pos < len(rc.in) {
+		rc.code |= uint32(rc.in[rc.pos])
+		rc.pos++
+		return
+	}
+	rc.overrun = true
+}
+
+// bit decodes a bit with the probability p, updating it
+func (rc *rangeDecoder) bit(p *uint16) (b uint32) {
+	bound := (rc.rng >> 11) * uint32(*p)
+	if rc.code < bound {
+		rc.rng = bound
+		*p += (1<<11 - *p) >> 5
+	} else {
+		rc.rng -= bound
+		rc.code -= bound
+		*p -= *p >> 5
+		b = 1
+	}
+	rc.normalize()
+	return b
+}
+
+// direct decodes n bits with fixed probabilities
+func (rc *rangeDecoder) direct(n uint) (v uint32) {
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		v <<= 1
+		if rc.code >= rc.rng {
+			rc.code -= rc.rng
+			v |= 1
+		}
+		rc.normalize()
+	}
+	return v
+}
+
+// tree decodes n bits most significant first with a bit tree of probabilities
+func (rc *rangeDecoder) tree(probs []uint16, n uint) (v uint32) {
+	m := uint32(1)
+	for i := uint(0); i < n; i++ {
+		m = m<<1 | rc.bit(&probs[m])
+	}
+	return m - 1<<n
+}
+
+// reverse decodes n bits least significant first with a bit tree of probabilities
+func (rc *rangeDecoder) reverse(probs []uint16, n uint) (v uint32) {
+	m := uint32(1)
+	for i := uint(0); i < n; i++ {
+		b := rc.bit(&probs[m])
+		m = m<<1 | b
+		v |= b << i
+	}
+	return v
+}
+
+// dictionary holds the decoded history up to the dictionary size
+// and the output of the current chunk
+type dictionary struct {
+	buf   []byte // history, circular once it reaches size
+	size  int
+	pos   int    // next write position once circular
+	total int    // bytes decoded since the dictionary reset
+	out   []byte // output of the current chunk
+}
+
+func (d *dictionary) reset() {
+	d.buf = d.buf[:0]
+	d.pos = 0
+	d.total = 0
+}
+
+func (d *dictionary) put(b byte) {
+	if len(d.buf) < d.size {
+		d.buf = append(d.buf, b)
+	} else {
+		d.buf[d.pos] = b
+		if d.pos++; d.pos == d.size {
+			d.pos = 0
+		}
+	}
+	d.total++
+	d.out = append(d.out, b)
+}
+
+// get returns the byte at distance dist, which must be within the history
+func (d *dictionary) get(dist int) byte {
+	if len(d.buf) < d.size {
+		return d.buf[len(d.buf)-dist]
+	}
+	i := d.pos - dist
+	if i < 0 {
+		i += d.size
+	}
+	return d.buf[i]
+}
+
+// copy repeats n bytes from distance dist, which must be within the history
+func (d *dictionary) copy(dist, n int) {
+	for ; n > 0; n-- {
+		d.put(d.get(dist))
+	}
+}
+
+// lengthDecoder decodes match lengths
+type lengthDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [posStatesMax][1 << 3]uint16
+	mid     [posStatesMax][1 << 3]uint16
+	high    [1 << 8]uint16
+}
+
+func (ld *lengthDecoder) reset() {
+	ld.choice = probInit
+	ld.choice2 = probInit
+	for i := range ld.low {
+		fill(ld.low[i][:])
+		fill(ld.mid[i][:])
+	}
+	fill(ld.high[:])
+}
+
+// decode returns a match length from 2 to 273
+func (ld *lengthDecoder) decode(rc *rangeDecoder, posState uint32) (n int) {
+	if rc.bit(&ld.choice) == 0 {
+		return 2 + int(rc.tree(ld.low[posState][:], 3))
+	}
+	if rc.bit(&ld.choice2) == 0 {
+		return 2 + 8 + int(rc.tree(ld.mid[posState][:], 3))
+	}
+	return 2 + 16 + int(rc.tree(ld.high[:], 8))
+}
+
+// lzmaDecoder decodes LZMA chunks of a LZMA2 stream
+type lzmaDecoder struct {
+	lc, lp, pb uint
+	state      uint32
+	rep        [4]uint32 // distances of the last matches minus one
+
+	isMatch    [states * posStatesMax]uint16
+	isRep      [states]uint16
+	isRepG0    [states]uint16
+	isRepG1    [states]uint16
+	isRepG2    [states]uint16
+	isRep0Long [states * posStatesMax]uint16
+	literal    []uint16
+	posSlot    [4][1 << 6]uint16
+	posSpecial [1 + 128 - 14]uint16
+	align      [1 << 4]uint16
+	matchLen   lengthDecoder
+	repLen     lengthDecoder
+}
+
+// setProps sets the lc, lp and pb properties from the encoded byte
+func (l *lzmaDecoder) setProps(b byte) (ok bool) {
+	if b >= 9*5*5 {
+		return false
+	}
+	l.lc = uint(b % 9)
+	b /= 9
+	l.lp = uint(b % 5)
+	l.pb = uint(b / 5)
+	if l.lc+l.lp > 4 {
+		return false
+	}
+
+	if n := 0x300 << (l.lc + l.lp); cap(l.literal) >= n {
+		l.literal = l.literal[:n]
+	} else {
+		l.literal = make([]uint16, n)
+	}
+	return true
+}
+
+// reset the decoder state and probabilities
+func (l *lzmaDecoder) reset() {
+	l.state = 0
+	l.rep = [4]uint32{}
+	fill(l.isMatch[:])
+	fill(l.isRep[:])
+	fill(l.isRepG0[:])
+	fill(l.isRepG1[:])
+	fill(l.isRepG2[:])
+	fill(l.isRep0Long[:])
+	fill(l.literal)
+	for i := range l.posSlot {
+		fill(l.posSlot[i][:])
+	}
+	fill(l.posSpecial[:])
+	fill(l.align[:])
+	l.matchLen.reset()
+	l.repLen.reset()
+}
+
+// decode decodes n bytes into the dictionary
+func (l *lzmaDecoder) decode(rc *rangeDecoder, d *dictionary, n int) (err error) {
+	end := d.total + n
+	pbMask := uint32(1)<<l.pb - 1
+
+	for d.total < end {
+		posState := uint32(d.total) & pbMask
+
+		if rc.bit(&l.isMatch[l.state<<4|posState]) == 0 {
+			if l.state >= 7 && int(l.rep[0]) >= len(d.buf) {
+				return errFormat
+			}
+			l.decodeLiteral(rc, d)
+			continue
+		}
+
+		var length int
+		if rc.bit(&l.isRep[l.state]) == 0 {
+			length = l.matchLen.decode(rc, posState)
+			l.rep[3], l.rep[2], l.rep[1] = l.rep[2], l.rep[1], l.rep[0]
+			if l.rep[0] = l.distance(rc, length); l.rep[0] == endMarker {
+				// end markers are not allowed in LZMA2 chunks
+				return errFormat
+			}
+			l.state = next(l.state, 7, 10)
+
+		} else {
+			if len(d.buf) == 0 {
+				return errFormat
+			}
+
+			if rc.bit(&l.isRepG0[l.state]) == 0 {
+				if rc.bit(&l.isRep0Long[l.state<<4|posState]) == 0 {
+					// a single byte at the last distance
+					l.state = next(l.state, 9, 11)
+					if int(l.rep[0]) >= len(d.buf) {
+						return errFormat
+					}
+					d.put(d.get(int(l.rep[0]) + 1))
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&l.isRepG1[l.state]) == 0 {
+					dist = l.rep[1]
+				} else {
+					if rc.bit(&l.isRepG2[l.state]) == 0 {
+						dist = l.rep[2]
+					} else {
+						dist = l.rep[3]
+						l.rep[3] = l.rep[2]
+					}
+					l.rep[2] = l.rep[1]
+				}
+				l.rep[1] = l.rep[0]
+				l.rep[0] = dist
+			}
+
+			length = l.repLen.decode(rc, posState)
+			l.state = next(l.state, 8, 11)
+		}
+
+		dist := int(l.rep[0]) + 1
+		if dist > len(d.buf) || length > end-d.total {
+			return errFormat
+		}
+		d.copy(dist, length)
+	}
+
+	if rc.overrun {
+		return errFormat
+	}
+	return nil
+}
+
+// decodeLiteral decodes a literal byte into the dictionary
+func (l *lzmaDecoder) decodeLiteral(rc *rangeDecoder, d *dictionary) {
+	var prev uint32
+	if len(d.buf) > 0 {
+		prev = uint32(d.get(1))
+	}
+
+	lpMask := 1<<l.lp - 1
+	i := 0x300 * (d.total&lpMask<<l.lc | int(prev>>(8-l.lc)))
+	probs := l.literal[i : i+0x300]
+
+	symbol := uint32(1)
+	if l.state >= 7 {
+		// the literal after a match is coded with the byte at the match distance
+		match := uint32(d.get(int(l.rep[0]) + 1))
+		for symbol < 0x100 {
+			matchBit := match >> 7 & 1
+			match <<= 1
+			b := rc.bit(&probs[(1+matchBit)<<8+symbol])
+			symbol = symbol<<1 | b
+			if matchBit != b {
+				break
+			}
+		}
+	}
+
+	for symbol < 0x100 {
+		symbol = symbol<<1 | rc.bit(&probs[symbol])
+	}
+	d.put(byte(symbol))
+
+	switch {
+	case l.state < 4:
+		l.state = 0
+	case l.state < 10:
+		l.state -= 3
+	default:
+		l.state -= 6
+	}
+}
+
+// distance decodes the distance minus one of a match with the given length
+func (l *lzmaDecoder) distance(rc *rangeDecoder, length int) (dist uint32) {
+	lenState := length - 2
+	if lenState > 3 {
+		lenState = 3
+	}
+
+	slot := rc.tree(l.posSlot[lenState][:], 6)
+	if slot < 4 {
+		return slot
+	}
+
+	n := uint(slot>>1) - 1
+	dist = (2 | slot&1) << n
+	if slot < 14 {
+		return dist + rc.reverse(l.posSpecial[dist-slot:], n)
+	}
+
+	dist += rc.direct(n-4) << 4
+	return dist + rc.reverse(l.align[:], 4)
+}
+
+// next returns the state after a match, rep or short rep
+func next(state, lit, match uint32) uint32 {
+	if state < 7 {
+		return lit
+	}
+	return match
+}
+
+func fill(probs []uint16) {
+	for i := range probs {
+		probs[i] = probInit
+	}
+}
@@ -0,0 +1,164 @@
+package xz
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// lzma2Reader decodes a LZMA2 stream
+type lzma2Reader struct {
+	r         io.Reader
+	dict      dictionary
+	lzma      lzmaDecoder
+	rc        rangeDecoder
+	chunk     []byte
+	off       int  // read offset of dict.out
+	needDict  bool // the next chunk must reset the dictionary
+	needProps bool // the next LZMA chunk must set properties
+	eos       bool
+}
+
+// newLZMA2Reader creates a LZMA2 reader from the encoded dictionary size
+func newLZMA2Reader(r io.Reader, props byte) (l *lzma2Reader, err error) {
+	if props > 40 {
+		return nil, errFormat
+	}
+
+	size := uint64(1)<<32 - 1
+	if props < 40 {
+		size = (2 | uint64(props)&1) << (props/2 + 11)
+	}
+
+	// the history grows as needed up to the dictionary size
+	if size > math.MaxInt32 {
+		size = math.MaxInt32
+	}
+
+	l = &lzma2Reader{r: r, needDict: true, needProps: true}
+	l.dict.size = int(size)
+	return l, nil
+}
+
+func (l *lzma2Reader) Read(p []byte) (n int, err error) {
+	for l.off == len(l.dict.out) {
+		if l.eos {
+			return 0, io.EOF
+		}
+
+		l.off = 0
+		l.dict.out = l.dict.out[:0]
+		if err = l.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, l.dict.out[l.off:])
+	l.off += n
+	return n, nil
+}
+
+// next decodes the next chunk
+func (l *lzma2Reader) next() (err error) {
+	var b [6]byte
+	if _, err = io.ReadFull(l.r, b[:1]); err != nil {
+		return unexpected(err)
+	}
+	control := b[0]
+
+	switch {
+	case control == 0x00:
+		l.eos = true
+		return nil
+
+	case control >= 0x80 && control < 0xE0 && l.needDict:
+		return errFormat
+
+	case control >= 0xE0 || control == 0x01:
+		l.needProps = true
+		l.needDict = false
+		l.dict.reset()
+
+	case control == 0x02 && l.needDict:
+		return errFormat
+
+	case control > 0x02 && control < 0x80:
+		return errFormat
+	}
+
+	if control < 0x80 {
+		// uncompressed chunk
+		if _, err = io.ReadFull(l.r, b[:2]); err != nil {
+			return unexpected(err)
+		}
+
+		l.chunk = grow(l.chunk, int(binary.BigEndian.Uint16(b[:2]))+1)
+		if _, err = io.ReadFull(l.r, l.chunk); err != nil {
+			return unexpected(err)
+		}
+
+		for _, c := range l.chunk {
+			l.dict.put(c)
+		}
+		return nil
+	}
+
+	reset := control >> 5 & 3
+	header := b[:4]
+	if reset >= 2 {
+		header = b[:5]
+	}
+	if _, err = io.ReadFull(l.r, header); err != nil {
+		return unexpected(err)
+	}
+
+	unpacked := int(control&0x1F)<<16 + int(binary.BigEndian.Uint16(b[0:2])) + 1
+	packed := int(binary.BigEndian.Uint16(b[2:4])) + 1
+
+	switch {
+	case reset >= 2:
+		if !l.lzma.setProps(b[4]) {
+			return errFormat
+		}
+		l.needProps = false
+		l.lzma.reset()
+	case l.needProps:
+		return errFormat
+	case reset == 1:
+		l.lzma.reset()
+	}
+
+	l.chunk = grow(l.chunk, packed)
+	if _, err = io.ReadFull(l.r, l.chunk); err != nil {
+		return unexpected(err)
+	}
+
+	if !l.rc.init(l.chunk) {
+		return errFormat
+	}
+
+	if err = l.lzma.decode(&l.rc, &l.dict, unpacked); err != nil {
+		return err
+	}
+
+	if !l.rc.finished() {
+		return errFormat
+	}
+	return nil
+}
+
+// grow returns b resized to n bytes
+func grow(b []byte, n int) []byte {
+	if cap(b) >= n {
+		return b[:n]
+	}
+	return make([]byte, n)
+}
+
+// unexpected converts io.EOF to io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,424 @@
+// Package xz implements a decoder for the xz format with LZMA2 compressed
+// blocks, as written by xz utils with the default filter chain.
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+var (
+	errFormat      = errors.New("xz: invalid format")
+	errChecksum    = errors.New("xz: invalid checksum")
+	errUnsupported = errors.New("xz: unsupported filter")
+)
+
+const (
+	filterLZMA2 = 0x21
+	checkNone   = 0x00
+	checkCRC32  = 0x01
+	checkCRC64  = 0x04
+	checkSHA256 = 0x0A
+)
+
+var (
+	headerMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+	footerMagic = []byte{'Y', 'Z'}
+	crc64Table  = crc64.MakeTable(crc64.ECMA)
+)
+
+// record is an index record of a decoded block
+type record struct {
+	unpadded     int64
+	uncompressed int64
+}
+
+// Reader decompresses a xz stream, or several concatenated streams
+type Reader struct {
+	r       *bufio.Reader
+	flags   [2]byte   // stream flags
+	check   hash.Hash // block check, nil if not verified
+	records []record
+	block   *blockReader
+	err     error
+}
+
+// NewReader creates a Reader from r, reading the first stream header
+func NewReader(r io.Reader) (z *Reader, err error) {
+	z = &Reader{r: bufio.NewReader(r)}
+	if err = z.streamHeader(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *Reader) Read(p []byte) (n int, err error) {
+	for z.err == nil {
+		if z.block == nil {
+			z.err = z.next()
+			continue
+		}
+
+		if n, err = z.block.Read(p); n > 0 {
+			return n, nil
+		}
+
+		if err == io.EOF {
+			err = z.endBlock()
+		}
+		z.err = err
+	}
+
+	return 0, z.err
+}
+
+// next starts the next block, or reads the index and the stream footer
+func (z *Reader) next() (err error) {
+	first, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+
+	if first != 0 {
+		return z.blockHeader(first)
+	}
+
+	if err = z.index(); err != nil {
+		return err
+	}
+
+	// skip the stream padding and decode concatenated streams
+	for {
+		pad, err := z.r.Peek(4)
+		switch {
+		case len(pad) == 0 && err == io.EOF:
+			return io.EOF
+		case len(pad) < 4:
+			return unexpected(err)
+		case bytes.Equal(pad, []byte{0, 0, 0, 0}):
+			_, _ = z.r.Discard(4)
+		default:
+			return z.streamHeader()
+		}
+	}
+}
+
+// streamHeader reads and validates the stream header
+func (z *Reader) streamHeader() (err error) {
+	var h [12]byte
+	if _, err = io.ReadFull(z.r, h[:]); err != nil {
+		return unexpected(err)
+	}
+
+	if !bytes.Equal(h[:6], headerMagic) || h[6] != 0 || h[7] > 0x0F {
+		return errFormat
+	}
+
+	if crc32.ChecksumIEEE(h[6:8]) != binary.LittleEndian.Uint32(h[8:]) {
+		return errChecksum
+	}
+
+	z.flags = [2]byte{h[6], h[7]}
+	z.records = z.records[:0]
+
+	switch h[7] {
+	case checkCRC32:
+		z.check = crc32.NewIEEE()
+	case checkCRC64:
+		z.check = crc64.New(crc64Table)
+	case checkSHA256:
+		z.check = sha256.New()
+	default:
+		// other checks are skipped
+		z.check = nil
+	}
+
+	return nil
+}
+
+// checkSize returns the size of the block check
+func (z *Reader) checkSize() (n int) {
+	if z.flags[1] == checkNone {
+		return 0
+	}
+	return 4 << ((z.flags[1] - 1) / 3)
+}
+
+// blockHeader reads the block header and starts decoding the block
+func (z *Reader) blockHeader(first byte) (err error) {
+	h := make([]byte, (int(first)+1)*4)
+	h[0] = first
+	if _, err = io.ReadFull(z.r, h[1:]); err != nil {
+		return unexpected(err)
+	}
+
+	end := len(h) - 4
+	if crc32.ChecksumIEEE(h[:end]) != binary.LittleEndian.Uint32(h[end:]) {
+		return errChecksum
+	}
+	h = h[:end]
+
+	flags := h[1]
+	if flags&0x3C != 0 {
+		return errUnsupported
+	}
+
+	b := &blockReader{header: int64(end + 4), compressed: -1, uncompressed: -1}
+	p := 2
+
+	if flags&0x40 != 0 {
+		if b.compressed, p = varint(h, p); p < 0 || b.compressed == 0 {
+			return errFormat
+		}
+	}
+
+	if flags&0x80 != 0 {
+		if b.uncompressed, p = varint(h, p); p < 0 {
+			return errFormat
+		}
+	}
+
+	filters := int(flags&3) + 1
+	var props []byte
+	for i := 0; i < filters; i++ {
+		var id, size int64
+		if id, p = varint(h, p); p < 0 {
+			return errFormat
+		}
+		if size, p = varint(h, p); p < 0 || size > int64(len(h)-p) {
+			return errFormat
+		}
+
+		// only a single LZMA2 filter is supported
+		if id != filterLZMA2 || filters > 1 {
+			return errUnsupported
+		}
+		props = h[p : p+int(size)]
+		p += int(size)
+	}
+
+	if len(props) != 1 {
+		return errFormat
+	}
+
+	for ; p < len(h); p++ {
+		if h[p] != 0 {
+			return errFormat
+		}
+	}
+
+	b.count.r = z.r
+	if b.lzma2, err = newLZMA2Reader(&b.count, props[0]); err != nil {
+		return err
+	}
+
+	if z.check != nil {
+		z.check.Reset()
+	}
+	b.check = z.check
+	z.block = b
+	return nil
+}
+
+// endBlock reads the block padding and check once the block is decoded
+func (z *Reader) endBlock() (err error) {
+	b := z.block
+	z.block = nil
+
+	if (b.compressed >= 0 && b.compressed != b.count.n) ||
+		(b.uncompressed >= 0 && b.uncompressed != b.size) {
+		return errFormat
+	}
+
+	var buf [64]byte
+	pad := (4 - b.count.n%4) % 4
+	if _, err = io.ReadFull(z.r, buf[:pad]); err != nil {
+		return unexpected(err)
+	}
+
+	for _, c := range buf[:pad] {
+		if c != 0 {
+			return errFormat
+		}
+	}
+
+	size := z.checkSize()
+	if _, err = io.ReadFull(z.r, buf[:size]); err != nil {
+		return unexpected(err)
+	}
+
+	if z.check != nil {
+		sum := z.check.Sum(buf[size:size])
+		if size <= 8 {
+			// crc checks are stored in little endian
+			for i, j := 0, size-1; i < j; i, j = i+1, j-1 {
+				sum[i], sum[j] = sum[j], sum[i]
+			}
+		}
+
+		if !bytes.Equal(sum, buf[:size]) {
+			return errChecksum
+		}
+	}
+
+	z.records = append(z.records,
+		record{unpadded: b.header + b.count.n + int64(size), uncompressed: b.size})
+	return nil
+}
+
+// index reads and validates the index against the decoded blocks,
+// and the stream footer following it
+func (z *Reader) index() (err error) {
+	h := crc32.NewIEEE()
+	r := &indexReader{r: z.r, h: h, n: 1}
+	h.Write([]byte{0})
+
+	count, err := r.varint()
+	if err != nil {
+		return err
+	}
+
+	if count != int64(len(z.records)) {
+		return errFormat
+	}
+
+	for _, rec := range z.records {
+		var unpadded, uncompressed int64
+		if unpadded, err = r.varint(); err != nil {
+			return err
+		}
+		if uncompressed, err = r.varint(); err != nil {
+			return err
+		}
+		if unpadded != rec.unpadded || uncompressed != rec.uncompressed {
+			return errFormat
+		}
+	}
+
+	for r.n%4 != 0 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != 0 {
+			return errFormat
+		}
+	}
+
+	var f [16]byte
+	if _, err = io.ReadFull(z.r, f[:]); err != nil {
+		return unexpected(err)
+	}
+
+	if h.Sum32() != binary.LittleEndian.Uint32(f[:4]) {
+		return errChecksum
+	}
+
+	// stream footer
+	footer := f[4:]
+	if crc32.ChecksumIEEE(footer[4:10]) != binary.LittleEndian.Uint32(footer[:4]) {
+		return errChecksum
+	}
+
+	if int64(binary.LittleEndian.Uint32(footer[4:8])) != (r.n+4)/4-1 ||
+		footer[8] != z.flags[0] || footer[9] != z.flags[1] ||
+		!bytes.Equal(footer[10:], footerMagic) {
+		return errFormat
+	}
+
+	return nil
+}
+
+// blockReader decodes the data of a block
+type blockReader struct {
+	header       int64 // header size
+	compressed   int64 // declared compressed size, -1 if absent
+	uncompressed int64 // declared uncompressed size, -1 if absent
+	size         int64 // decoded size
+	count        countReader
+	lzma2        *lzma2Reader
+	check        hash.Hash
+}
+
+func (b *blockReader) Read(p []byte) (n int, err error) {
+	n, err = b.lzma2.Read(p)
+	b.size += int64(n)
+	if b.check != nil {
+		b.check.Write(p[:n])
+	}
+	return n, err
+}
+
+// countReader counts the bytes read
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// indexReader reads the index, counting and hashing the bytes read
+type indexReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+	n int64
+}
+
+func (r *indexReader) ReadByte() (c byte, err error) {
+	if c, err = r.r.ReadByte(); err != nil {
+		return 0, unexpected(err)
+	}
+	r.n++
+	r.h.Write([]byte{c})
+	return c, nil
+}
+
+// varint reads a multibyte integer
+func (r *indexReader) varint() (v int64, err error) {
+	for i := 0; i < 9; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if c == 0 && i > 0 {
+			return 0, errFormat
+		}
+
+		v |= int64(c&0x7F) << (7 * i)
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errFormat
+}
+
+// varint decodes a multibyte integer from b at p, returning the next
+// position or -1 if invalid
+func varint(b []byte, p int) (v int64, next int) {
+	for i := 0; i < 9 && p < len(b); i++ {
+		c := b[p]
+		p++
+
+		if c == 0 && i > 0 {
+			return 0, -1
+		}
+
+		v |= int64(c&0x7F) << (7 * i)
+		if c&0x80 == 0 {
+			return v, p
+		}
+	}
+	return 0, -1
+}
@@ -0,0 +1,110 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// text generates the log like text compressed in testdata
+func text(n int) []byte {
+	words := []string{"error", "warning", "info", "debug", "connection", "refused", "timeout", "user",
+		"request", "GET", "/api/v1/items", "200", "404", "500", "latency", "ms"}
+	b := make([]byte, 0, n+16)
+	x := uint32(1)
+	for len(b) < n {
+		x = x*1664525 + 1013904223
+		b = append(b, words[x>>28]...)
+		if x&0x1F00 == 0 {
+			b = append(b, '\n')
+		} else {
+			b = append(b, ' ')
+		}
+	}
+	return b[:n]
+}
+
+// random generates the incompressible data compressed in testdata
+func random(n int) []byte {
+	b := make([]byte, n)
+	x := uint32(7)
+	for i := range b {
+		x = x*1664525 + 1013904223
+		b[i] = byte(x >> 24)
+	}
+	return b
+}
+
+func readFile(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	plain := text(32768)
+	crc32Data := readFile(t, "text-crc32.xz")
+	noneData := readFile(t, "text-none.xz")
+
+	var concat []byte
+	concat = append(concat, crc32Data...)
+	concat = append(concat, 0, 0, 0, 0)
+	concat = append(concat, noneData...)
+
+	corrupt := append([]byte(nil), readFile(t, "text.xz")...)
+	corrupt[len(corrupt)/2] ^= 0x55
+
+	truncated := crc32Data[:len(crc32Data)-1]
+
+	readerCases := []struct {
+		name   string
+		data   []byte
+		expect []byte
+		err    bool
+	}{
+		{"crc64", readFile(t, "text.xz"), plain, false},
+		{"crc32", crc32Data, plain, false},
+		{"sha256_lc_lp_pb", readFile(t, "text-sha256.xz"), plain, false},
+		{"none", noneData, plain, false},
+		{"blocks", readFile(t, "text-blocks.xz"), plain, false},
+		{"small_dictionary", readFile(t, "text-dict4k.xz"), plain, false},
+		{"uncompressed_chunks", readFile(t, "random.xz"), random(8192), false},
+		{"concatenated", concat, append(append([]byte(nil), plain...), plain...), false},
+		{"corrupt", corrupt, nil, true},
+		{"truncated", truncated, nil, true},
+		{"trailing_garbage", append(append([]byte(nil), noneData...), 1, 2, 3, 4), nil, true},
+	}
+
+	for _, testCase := range readerCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(testCase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := io.ReadAll(r)
+			if testCase.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(data, testCase.expect) {
+				t.Fatal("not equal: ", len(data), len(testCase.expect))
+			}
+		})
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not xz data"))); err == nil {
+		t.Fatal("expected error for invalid header")
+	}
+}
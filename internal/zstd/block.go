@@ -0,0 +1,358 @@
+package zstd
+
+import (
+	"encoding/binary"
+)
+
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+)
+
+var (
+	llBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536}
+	llBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16}
+	mlBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	mlBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16}
+
+	predefinedLL = predefined([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1}, 6)
+	predefinedML = predefined([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1}, 6)
+	predefinedOF = predefined([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+func predefined(norm []int16, log uint8) (t *fseTable) {
+	t = &fseTable{}
+	if err := t.build(norm, log); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// compressed decodes a compressed block appending its content to the history
+func (z *Reader) compressed(data []byte) (err error) {
+	lits, n, err := z.literals(data)
+	if err != nil {
+		return err
+	}
+	return z.sequences(data[n:], lits)
+}
+
+// literals decodes the literals section, returning the number of bytes read
+func (z *Reader) literals(data []byte) (lits []byte, n int, err error) {
+	if len(data) == 0 {
+		return nil, 0, errFormat
+	}
+
+	kind := data[0] & 3
+	format := data[0] >> 2 & 3
+
+	if kind == literalsRaw || kind == literalsRLE {
+		var size int
+		switch format {
+		case 0, 2:
+			size = int(data[0] >> 3)
+			n = 1
+		case 1:
+			if len(data) < 2 {
+				return nil, 0, errFormat
+			}
+			size = int(data[0]>>4) + int(data[1])<<4
+			n = 2
+		case 3:
+			if len(data) < 3 {
+				return nil, 0, errFormat
+			}
+			size = int(data[0]>>4) + int(data[1])<<4 + int(data[2])<<12
+			n = 3
+		}
+
+		if kind == literalsRaw {
+			if n+size > len(data) {
+				return nil, 0, errFormat
+			}
+			return data[n : n+size], n + size, nil
+		}
+
+		if n+1 > len(data) || size > blockMax {
+			return nil, 0, errFormat
+		}
+
+		z.lits = grow(z.lits, size)
+		for i := range z.lits {
+			z.lits[i] = data[n]
+		}
+		return z.lits, n + 1, nil
+	}
+
+	var regenerated, compressed int
+	streams := 4
+
+	switch format {
+	case 0, 1:
+		if len(data) < 3 {
+			return nil, 0, errFormat
+		}
+		if format == 0 {
+			streams = 1
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		regenerated = int(v >> 4 & 0x3FF)
+		compressed = int(v >> 14 & 0x3FF)
+		n = 3
+	case 2:
+		if len(data) < 4 {
+			return nil, 0, errFormat
+		}
+		v := binary.LittleEndian.Uint32(data)
+		regenerated = int(v >> 4 & 0x3FFF)
+		compressed = int(v >> 18)
+		n = 4
+	case 3:
+		if len(data) < 5 {
+			return nil, 0, errFormat
+		}
+		v := uint64(binary.LittleEndian.Uint32(data)) | uint64(data[4])<<32
+		regenerated = int(v >> 4 & 0x3FFFF)
+		compressed = int(v >> 22 & 0x3FFFF)
+		n = 5
+	}
+
+	if regenerated > blockMax || n+compressed > len(data) {
+		return nil, 0, errFormat
+	}
+
+	src := data[n : n+compressed]
+	n += compressed
+
+	if kind == literalsCompressed {
+		hn, err := z.huffman.read(src)
+		if err != nil {
+			return nil, 0, err
+		}
+		src = src[hn:]
+		z.hasHuffman = true
+	} else if !z.hasHuffman {
+		return nil, 0, errFormat
+	}
+
+	z.lits = grow(z.lits, regenerated)
+	if streams == 1 {
+		return z.lits, n, z.huffman.decode(z.lits, src)
+	}
+
+	// four streams with a jump table of the sizes of the first three
+	if len(src) < 6 {
+		return nil, 0, errFormat
+	}
+
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(src[0:])),
+		int(binary.LittleEndian.Uint16(src[2:])),
+		int(binary.LittleEndian.Uint16(src[4:])),
+	}
+	src = src[6:]
+	sizes[3] = len(src) - sizes[0] - sizes[1] - sizes[2]
+
+	segment := (regenerated + 3) / 4
+	if sizes[3] < 0 || 3*segment > regenerated {
+		return nil, 0, errFormat
+	}
+
+	dst := z.lits
+	for i, size := range sizes {
+		out := dst
+		if i < 3 {
+			out = dst[:segment]
+		}
+
+		if err = z.huffman.decode(out, src[:size]); err != nil {
+			return nil, 0, err
+		}
+		dst = dst[len(out):]
+		src = src[size:]
+	}
+
+	return z.lits, n, nil
+}
+
+// sequences decodes and executes the sequences section
+func (z *Reader) sequences(data, lits []byte) (err error) {
+	if len(data) == 0 {
+		return errFormat
+	}
+
+	count := int(data[0])
+	n := 1
+	switch {
+	case count == 0:
+		if len(data) != 1 {
+			return errFormat
+		}
+		z.hist = append(z.hist, lits...)
+		return nil
+	case count == 255:
+		if len(data) < 3 {
+			return errFormat
+		}
+		count = int(data[1]) + int(data[2])<<8 + 0x7F00
+		n = 3
+	case count >= 128:
+		if len(data) < 2 {
+			return errFormat
+		}
+		count = (count-128)<<8 + int(data[1])
+		n = 2
+	}
+
+	if n >= len(data) || data[n]&3 != 0 {
+		return errFormat
+	}
+	modes := data[n]
+	n++
+
+	tables := []struct {
+		table      **fseTable
+		buf        *fseTable
+		predefined *fseTable
+		maxSymbol  int
+		maxLog     uint8
+		mode       byte
+	}{
+		{&z.ll, &z.llBuf, predefinedLL, len(llBase) - 1, 9, modes >> 6},
+		{&z.of, &z.ofBuf, predefinedOF, 31, 8, modes >> 4 & 3},
+		{&z.ml, &z.mlBuf, predefinedML, len(mlBase) - 1, 9, modes >> 2 & 3},
+	}
+
+	for _, t := range tables {
+		switch t.mode {
+		case modePredefined:
+			*t.table = t.predefined
+		case modeRLE:
+			if n >= len(data) || int(data[n]) > t.maxSymbol {
+				return errFormat
+			}
+			t.buf.rle(data[n])
+			*t.table = t.buf
+			n++
+		case modeCompressed:
+			tn, err := t.buf.read(data[n:], t.maxSymbol, t.maxLog)
+			if err != nil {
+				return err
+			}
+			*t.table = t.buf
+			n += tn
+		case modeRepeat:
+			if *t.table == nil {
+				return errFormat
+			}
+		}
+	}
+
+	var br bitReader
+	if err = br.init(data[n:]); err != nil {
+		return err
+	}
+
+	ll, of, ml := z.ll, z.of, z.ml
+	llState := br.read(ll.log)
+	ofState := br.read(of.log)
+	mlState := br.read(ml.log)
+
+	start := len(z.hist)
+	for i := 0; i < count; i++ {
+		lle := ll.entries[llState]
+		ofe := of.entries[ofState]
+		mle := ml.entries[mlState]
+
+		offset := int(1<<ofe.symbol + br.read(ofe.symbol))
+		matchLen := int(mlBase[mle.symbol]) + int(br.read(mlBits[mle.symbol]))
+		litLen := int(llBase[lle.symbol]) + int(br.read(llBits[lle.symbol]))
+
+		if i < count-1 {
+			llState = uint64(lle.base) + br.read(lle.bits)
+			mlState = uint64(mle.base) + br.read(mle.bits)
+			ofState = uint64(ofe.base) + br.read(ofe.bits)
+		}
+
+		if offset > 3 {
+			offset -= 3
+			z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+		} else {
+			// repeat offsets are shifted by one when there are no literals
+			if litLen == 0 {
+				offset++
+			}
+
+			switch offset {
+			case 1:
+				offset = z.rep[0]
+			case 2:
+				offset = z.rep[1]
+				z.rep[0], z.rep[1] = offset, z.rep[0]
+			case 3:
+				offset = z.rep[2]
+				z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+			case 4:
+				offset = z.rep[0] - 1
+				z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+			}
+		}
+
+		if litLen > len(lits) {
+			return errFormat
+		}
+		z.hist = append(z.hist, lits[:litLen]...)
+		lits = lits[litLen:]
+
+		if offset <= 0 || offset > len(z.hist) || len(z.hist)-start+matchLen > blockMax {
+			return errFormat
+		}
+
+		from := len(z.hist) - offset
+		if offset >= matchLen {
+			z.hist = append(z.hist, z.hist[from:from+matchLen]...)
+			continue
+		}
+
+		for j := 0; j < matchLen; j++ {
+			z.hist = append(z.hist, z.hist[from+j])
+		}
+	}
+
+	if br.pos != 0 {
+		return errFormat
+	}
+
+	z.hist = append(z.hist, lits...)
+	return nil
+}
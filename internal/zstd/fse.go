@@ -0,0 +1,363 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// bitReader reads a backward bitstream, from the last bit to the first
+type bitReader struct {
+	data []byte
+	pos  int // bits left, negative once read past the start
+}
+
+// init starts reading data after the padding of its last byte
+func (b *bitReader) init(data []byte) (err error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return errFormat
+	}
+	b.data = data
+	b.pos = (len(data)-1)*8 + bits.Len8(data[len(data)-1]) - 1
+	return nil
+}
+
+// read n bits, up to 56
+func (b *bitReader) read(n uint8) (v uint64) {
+	v = b.peek(n)
+	b.pos -= int(n)
+	return v
+}
+
+// peek returns the next n bits, bits past the start of the stream read as zeros
+func (b *bitReader) peek(n uint8) (v uint64) {
+	if n == 0 {
+		return 0
+	}
+
+	p := b.pos - int(n)
+	if p >= 0 {
+		return b.window(p) & (1<<n - 1)
+	}
+
+	k := int(n) + p
+	if k <= 0 {
+		return 0
+	}
+	return (b.window(0) & (1<<uint(k) - 1)) << uint(-p)
+}
+
+// window returns 57 bits or more starting at the bit p
+func (b *bitReader) window(p int) (w uint64) {
+	i := p >> 3
+	if i+8 <= len(b.data) {
+		w = binary.LittleEndian.Uint64(b.data[i:])
+	} else {
+		for k := len(b.data) - 1; k >= i; k-- {
+			w = w<<8 | uint64(b.data[k])
+		}
+	}
+	return w >> uint(p&7)
+}
+
+// fseEntry is a FSE decoding table state
+type fseEntry struct {
+	symbol uint8
+	bits   uint8  // bits to read for the next state
+	base   uint16 // base of the next state
+}
+
+// fseTable is a FSE decoding table
+type fseTable struct {
+	log     uint8
+	entries [1 << maxTableLog]fseEntry
+}
+
+// rle sets a table decoding always the same symbol
+func (t *fseTable) rle(symbol uint8) {
+	t.log = 0
+	t.entries[0] = fseEntry{symbol: symbol}
+}
+
+// build the table from the normalized symbol counts
+func (t *fseTable) build(norm []int16, log uint8) (err error) {
+	size := 1 << log
+	high := size - 1
+
+	var next [256]uint16
+	for s, c := range norm {
+		if c == -1 {
+			t.entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = uint16(c)
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, c := range norm {
+		for i := 0; i < int(c); i++ {
+			t.entries[pos].symbol = uint8(s)
+			for pos = (pos + step) & mask; pos > high; pos = (pos + step) & mask {
+			}
+		}
+	}
+
+	if pos != 0 {
+		return errFormat
+	}
+
+	for u := 0; u < size; u++ {
+		e := &t.entries[u]
+		state := next[e.symbol]
+		next[e.symbol]++
+		e.bits = log - uint8(bits.Len16(state)-1)
+		e.base = state<<e.bits - uint16(size)
+	}
+
+	t.log = log
+	return nil
+}
+
+// read reads a FSE table description from src,
+// returning the number of bytes read
+func (t *fseTable) read(src []byte, maxSymbol int, maxLog uint8) (n int, err error) {
+	if len(src) == 0 {
+		return 0, errFormat
+	}
+
+	log := src[0]&0xF + 5
+	if log > maxLog {
+		return 0, errFormat
+	}
+
+	var norm [256]int16
+	pos := uint(4)
+	remaining := 1<<log + 1
+	threshold := 1 << log
+	nbits := uint(log) + 1
+	symbol := 0
+	zero := false
+
+	for remaining > 1 && symbol <= maxSymbol {
+		if zero {
+			// repeat flags of zero probability symbols
+			n0 := symbol
+			for {
+				r := int(peekForward(src, pos, 2))
+				pos += 2
+				n0 += r
+				if r != 3 {
+					break
+				}
+			}
+
+			if n0 > maxSymbol {
+				return 0, errFormat
+			}
+			symbol = n0
+		}
+
+		limit := 2*threshold - 1 - remaining
+		v := int(peekForward(src, pos, nbits))
+
+		var count int
+		if v&(threshold-1) < limit {
+			count = v & (threshold - 1)
+			pos += nbits - 1
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= limit
+			}
+			pos += nbits
+		}
+
+		// counts are stored plus one, -1 is a less than one probability
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+
+		if remaining < 1 {
+			return 0, errFormat
+		}
+
+		norm[symbol] = int16(count)
+		symbol++
+		zero = count == 0
+
+		for remaining < threshold {
+			nbits--
+			threshold >>= 1
+		}
+	}
+
+	if n = int(pos+7) / 8; remaining != 1 || n > len(src) {
+		return 0, errFormat
+	}
+
+	return n, t.build(norm[:symbol], log)
+}
+
+// peekForward returns n bits, up to 16, from a forward bitstream at pos
+func peekForward(src []byte, pos, n uint) (v uint32) {
+	i := int(pos / 8)
+	for k := 2; k >= 0; k-- {
+		v <<= 8
+		if i+k < len(src) {
+			v |= uint32(src[i+k])
+		}
+	}
+	return v >> (pos % 8) & (1<<n - 1)
+}
+
+// huffman is a Huffman decoding table, each entry has the symbol
+// in the high byte and the code length in the low byte
+type huffman struct {
+	log   uint8
+	table [1 << maxHuffmanLog]uint16
+}
+
+// read reads the Huffman tree description from src,
+// returning the number of bytes read
+func (h *huffman) read(src []byte) (n int, err error) {
+	if len(src) == 0 {
+		return 0, errFormat
+	}
+
+	var weights [256]uint8
+	var count int
+	header := int(src[0])
+
+	if header < 128 {
+		// FSE compressed weights
+		if n = 1 + header; n > len(src) {
+			return 0, errFormat
+		}
+		if count, err = fseWeights(src[1:n], &weights); err != nil {
+			return 0, err
+		}
+	} else {
+		// 4 bits weights
+		count = header - 127
+		if n = 1 + (count+1)/2; n > len(src) {
+			return 0, errFormat
+		}
+		for i := 0; i < count; i++ {
+			weights[i] = src[1+i/2] >> (4 * (1 - i%2)) & 0xF
+		}
+	}
+
+	var total uint32
+	for _, w := range weights[:count] {
+		if w > maxHuffmanLog {
+			return 0, errFormat
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+
+	if total == 0 {
+		return 0, errFormat
+	}
+
+	// the weight of the last symbol completes the total to a power of 2
+	log := uint8(bits.Len32(total))
+	rest := uint32(1)<<log - total
+	if log > maxHuffmanLog || rest&(rest-1) != 0 {
+		return 0, errFormat
+	}
+	weights[count] = uint8(bits.Len32(rest))
+	count++
+
+	var start [maxHuffmanLog + 2]int
+	for _, w := range weights[:count] {
+		start[w] += 1 << w >> 1
+	}
+
+	next := 0
+	for w := 1; w <= int(log); w++ {
+		next, start[w] = next+start[w], next
+	}
+
+	for s, w := range weights[:count] {
+		if w == 0 {
+			continue
+		}
+		entry := uint16(s)<<8 | uint16(log+1-w)
+		for i := 0; i < 1<<w>>1; i++ {
+			h.table[start[w]+i] = entry
+		}
+		start[w] += 1 << w >> 1
+	}
+
+	h.log = log
+	return n, nil
+}
+
+// decode decodes len(dst) symbols from a Huffman coded stream
+func (h *huffman) decode(dst, src []byte) (err error) {
+	var br bitReader
+	if err = br.init(src); err != nil {
+		return err
+	}
+
+	for i := range dst {
+		e := h.table[br.peek(h.log)]
+		dst[i] = byte(e >> 8)
+		br.pos -= int(e & 0xFF)
+	}
+
+	if br.pos != 0 {
+		return errFormat
+	}
+	return nil
+}
+
+// fseWeights decodes the FSE compressed Huffman weights,
+// returning the number of weights
+func fseWeights(src []byte, weights *[256]uint8) (n int, err error) {
+	var t fseTable
+	hn, err := t.read(src, 255, maxWeightsLog)
+	if err != nil {
+		return 0, err
+	}
+
+	var br bitReader
+	if err = br.init(src[hn:]); err != nil {
+		return 0, err
+	}
+
+	// two interleaved states until the stream is exhausted
+	s1 := br.read(t.log)
+	s2 := br.read(t.log)
+	for {
+		if n > 253 {
+			return 0, errFormat
+		}
+
+		e := t.entries[s1]
+		weights[n] = e.symbol
+		n++
+		s1 = uint64(e.base) + br.read(e.bits)
+		if br.pos < 0 {
+			weights[n] = t.entries[s2].symbol
+			return n + 1, nil
+		}
+
+		e = t.entries[s2]
+		weights[n] = e.symbol
+		n++
+		s2 = uint64(e.base) + br.read(e.bits)
+		if br.pos < 0 {
+			weights[n] = t.entries[s1].symbol
+			return n + 1, nil
+		}
+	}
+}
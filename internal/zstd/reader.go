@@ -0,0 +1,288 @@
+// Package zstd implements a decoder for the zstandard format,
+// frames using dictionaries are not supported.
+package zstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	errFormat      = errors.New("zstd: invalid format")
+	errChecksum    = errors.New("zstd: invalid checksum")
+	errUnsupported = errors.New("zstd: unsupported frame")
+)
+
+const (
+	frameMagic     = 0xFD2FB528
+	skippableMagic = 0x184D2A50
+	blockMax       = 128 << 10
+	windowMax      = 1 << 31
+	maxTableLog    = 9
+	maxHuffmanLog  = 11
+	maxWeightsLog  = 6
+
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// Reader decompresses a zstd stream of one or more frames
+type Reader struct {
+	r      *bufio.Reader
+	hist   []byte // frame content within the window followed by the unread output
+	off    int    // read offset of hist
+	window int
+	frame  bool  // decoding a frame
+	last   bool  // last block of the frame decoded
+	check  bool  // the frame has a content checksum
+	size   int64 // declared content size, -1 if absent
+	total  int64 // decoded content size
+	hash   xxhash
+	block  []byte
+	lits   []byte
+	err    error
+
+	huffman    huffman
+	hasHuffman bool
+	ll, of, ml *fseTable // tables used by the last block for repeat modes
+	llBuf      fseTable
+	ofBuf      fseTable
+	mlBuf      fseTable
+	rep        [3]int
+}
+
+// NewReader creates a Reader from r, reading the first frame header
+func NewReader(r io.Reader) (z *Reader, err error) {
+	z = &Reader{r: bufio.NewReader(r)}
+	if err = z.frameHeader(); err != nil {
+		return nil, unexpected(err)
+	}
+	return z, nil
+}
+
+func (z *Reader) Read(p []byte) (n int, err error) {
+	for z.off == len(z.hist) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+
+	n = copy(p, z.hist[z.off:])
+	z.off += n
+	return n, nil
+}
+
+// next decodes the next block, ends the current frame or starts the next one
+func (z *Reader) next() (err error) {
+	switch {
+	case !z.frame:
+		if _, err = z.r.Peek(1); err != nil {
+			return err
+		}
+		return z.frameHeader()
+	case z.last:
+		return z.endFrame()
+	}
+
+	// keep only the window of the content already read
+	if excess := len(z.hist) - z.window; excess > z.window {
+		z.hist = z.hist[:copy(z.hist, z.hist[excess:])]
+	}
+	z.off = len(z.hist)
+
+	var h [3]byte
+	if _, err = io.ReadFull(z.r, h[:]); err != nil {
+		return unexpected(err)
+	}
+
+	v := uint32(h[0]) | uint32(h[1])<<8 | uint32(h[2])<<16
+	z.last = v&1 != 0
+	size := int(v >> 3)
+	if size > blockMax {
+		return errFormat
+	}
+
+	switch v >> 1 & 3 {
+	case blockRaw:
+		z.hist = append(z.hist, make([]byte, size)...)
+		if _, err = io.ReadFull(z.r, z.hist[z.off:]); err != nil {
+			return unexpected(err)
+		}
+
+	case blockRLE:
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		for i := 0; i < size; i++ {
+			z.hist = append(z.hist, b)
+		}
+
+	case blockCompressed:
+		z.block = grow(z.block, size)
+		if _, err = io.ReadFull(z.r, z.block); err != nil {
+			return unexpected(err)
+		}
+		if err = z.compressed(z.block); err != nil {
+			return err
+		}
+
+	default:
+		return errFormat
+	}
+
+	out := z.hist[z.off:]
+	z.total += int64(len(out))
+	if z.check {
+		z.hash.write(out)
+	}
+	return nil
+}
+
+// frameHeader reads the next frame header, skipping skippable frames
+func (z *Reader) frameHeader() (err error) {
+	var b [8]byte
+	for {
+		if _, err = io.ReadFull(z.r, b[:4]); err != nil {
+			return unexpected(err)
+		}
+
+		magic := binary.LittleEndian.Uint32(b[:4])
+		if magic == frameMagic {
+			break
+		}
+
+		if magic&0xFFFFFFF0 != skippableMagic {
+			return errFormat
+		}
+
+		if _, err = io.ReadFull(z.r, b[:4]); err != nil {
+			return unexpected(err)
+		}
+		size := int64(binary.LittleEndian.Uint32(b[:4]))
+		if n, err := io.CopyN(io.Discard, z.r, size); n != size {
+			return unexpected(err)
+		}
+
+		if _, err = z.r.Peek(1); err == io.EOF {
+			return io.EOF
+		}
+	}
+
+	desc, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+
+	if desc&0x08 != 0 {
+		return errFormat
+	}
+
+	single := desc&0x20 != 0
+	z.check = desc&0x04 != 0
+
+	var window uint64
+	if !single {
+		wd, err := z.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		base := uint64(1) << (10 + wd>>3)
+		window = base + base/8*uint64(wd&7)
+	}
+
+	if n := [4]int{0, 1, 2, 4}[desc&3]; n > 0 {
+		// dictionaries are not supported
+		if _, err = io.ReadFull(z.r, b[:n]); err != nil {
+			return unexpected(err)
+		}
+		b[n], b[n+1], b[n+2], b[n+3] = 0, 0, 0, 0
+		if binary.LittleEndian.Uint32(b[:4]) != 0 {
+			return errUnsupported
+		}
+	}
+
+	z.size = -1
+	n := [4]int{0, 2, 4, 8}[desc>>6]
+	if n == 0 && single {
+		n = 1
+	}
+
+	if n > 0 {
+		b = [8]byte{}
+		if _, err = io.ReadFull(z.r, b[:n]); err != nil {
+			return unexpected(err)
+		}
+		size := binary.LittleEndian.Uint64(b[:])
+		if n == 2 {
+			size += 256
+		}
+		if size >= 1<<62 {
+			return errUnsupported
+		}
+		z.size = int64(size)
+	}
+
+	if single {
+		window = uint64(z.size)
+	}
+
+	if window > windowMax {
+		return errUnsupported
+	}
+
+	z.window = int(window)
+	z.frame = true
+	z.last = false
+	z.total = 0
+	z.hash.reset()
+	z.hist = z.hist[:0]
+	z.off = 0
+	z.hasHuffman = false
+	z.ll, z.of, z.ml = nil, nil, nil
+	z.rep = [3]int{1, 4, 8}
+	return nil
+}
+
+// endFrame verifies the content size and checksum of the frame
+func (z *Reader) endFrame() (err error) {
+	z.frame = false
+
+	if z.size >= 0 && z.size != z.total {
+		return errFormat
+	}
+
+	if !z.check {
+		return nil
+	}
+
+	var b [4]byte
+	if _, err = io.ReadFull(z.r, b[:]); err != nil {
+		return unexpected(err)
+	}
+
+	if binary.LittleEndian.Uint32(b[:]) != uint32(z.hash.sum64()) {
+		return errChecksum
+	}
+	return nil
+}
+
+// grow returns b resized to n bytes
+func grow(b []byte, n int) []byte {
+	if cap(b) >= n {
+		return b[:n]
+	}
+	return make([]byte, n)
+}
+
+// unexpected converts io.EOF to io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// text generates the log like text compressed in testdata
+func text(n int) []byte {
+	words := []string{"error", "warning", "info", "debug", "connection", "refused", "timeout", "user",
+		"request", "GET", "/api/v1/items", "200", "404", "500", "latency", "ms"}
+	b := make([]byte, 0, n+16)
+	x := uint32(1)
+	for len(b) < n {
+		x = x*1664525 + 1013904223
+		b = append(b, words[x>>28]...)
+		if x&0x1F00 == 0 {
+			b = append(b, '\n')
+		} else {
+			b = append(b, ' ')
+		}
+	}
+	return b[:n]
+}
+
+// random generates the incompressible data compressed in testdata
+func random(n int) []byte {
+	b := make([]byte, n)
+	x := uint32(7)
+	for i := range b {
+		x = x*1664525 + 1013904223
+		b[i] = byte(x >> 24)
+	}
+	return b
+}
+
+func readFile(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	plain := text(32768)
+	data := readFile(t, "text.zst")
+	noCheck := readFile(t, "text-19.zst")
+
+	// skippable frames before, between and after frames
+	skippable := []byte{0x5A, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 'a', 'b', 'c'}
+	var concat []byte
+	concat = append(concat, skippable...)
+	concat = append(concat, data...)
+	concat = append(concat, skippable...)
+	concat = append(concat, noCheck...)
+	concat = append(concat, skippable...)
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0x55
+
+	badChecksum := append([]byte(nil), data...)
+	badChecksum[len(badChecksum)-1] ^= 0x01
+
+	readerCases := []struct {
+		name   string
+		data   []byte
+		expect []byte
+		err    bool
+	}{
+		{"default", data, plain, false},
+		{"level_19_no_check", noCheck, plain, false},
+		{"level_1", readFile(t, "text-1.zst"), plain, false},
+		{"streamed", readFile(t, "text-stream.zst"), plain, false},
+		{"small_window", readFile(t, "text-window.zst"), plain, false},
+		{"raw_blocks", readFile(t, "random.zst"), random(8192), false},
+		{"rle_blocks", readFile(t, "rle.zst"), bytes.Repeat([]byte("a"), 10000), false},
+		{"concatenated", concat, append(append([]byte(nil), plain...), plain...), false},
+		{"corrupt", corrupt, nil, true},
+		{"checksum", badChecksum, nil, true},
+		{"truncated", data[:len(data)-1], nil, true},
+		{"trailing_garbage", append(append([]byte(nil), data...), 1, 2, 3, 4), nil, true},
+	}
+
+	for _, testCase := range readerCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(testCase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := io.ReadAll(r)
+			if testCase.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(data, testCase.expect) {
+				t.Fatal("not equal: ", len(data), len(testCase.expect))
+			}
+		})
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not zstd data"))); err == nil {
+		t.Fatal("expected error for invalid header")
+	}
+}
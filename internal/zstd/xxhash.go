@@ -0,0 +1,100 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// xxhash computes the XXH64 hash with seed 0 of the frame content
+type xxhash struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int
+}
+
+func (h *xxhash) reset() {
+	// the accumulators wrap around
+	h.v = [4]uint64{prime1, prime2, 0, 0}
+	h.v[0] += prime2
+	h.v[3] -= prime1
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxhash) write(b []byte) {
+	h.total += uint64(len(b))
+
+	if h.n > 0 {
+		c := copy(h.mem[h.n:], b)
+		h.n += c
+		b = b[c:]
+		if h.n < 32 {
+			return
+		}
+		h.stripe(h.mem[:])
+		h.n = 0
+	}
+
+	for ; len(b) >= 32; b = b[32:] {
+		h.stripe(b)
+	}
+	h.n = copy(h.mem[:], b)
+}
+
+func (h *xxhash) stripe(b []byte) {
+	h.v[0] = round(h.v[0], binary.LittleEndian.Uint64(b[0:]))
+	h.v[1] = round(h.v[1], binary.LittleEndian.Uint64(b[8:]))
+	h.v[2] = round(h.v[2], binary.LittleEndian.Uint64(b[16:]))
+	h.v[3] = round(h.v[3], binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxhash) sum64() (s uint64) {
+	if h.total >= 32 {
+		s = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			s ^= round(0, v)
+			s = s*prime1 + prime4
+		}
+	} else {
+		s = h.v[2] + prime5
+	}
+	s += h.total
+
+	b := h.mem[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		s ^= round(0, binary.LittleEndian.Uint64(b))
+		s = bits.RotateLeft64(s, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		s ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		s = bits.RotateLeft64(s, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		s ^= uint64(c) * prime5
+		s = bits.RotateLeft64(s, 11) * prime1
+	}
+
+	s ^= s >> 33
+	s *= prime2
+	s ^= s >> 29
+	s *= prime3
+	s ^= s >> 32
+	return s
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
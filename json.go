@@ -2,30 +2,78 @@ package rxde
 
 import (
 	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/brunotm/rxde/expr"
+	"github.com/brunotm/rxde/rule"
 )
 
 // naive and fast json value appender for flat json documents
 // assumes well formated values and it doesn't handle espcaping for keys
 // o no ',",\ or control characters
 func appendJSON(data []byte, key string, value []byte) (newData []byte) {
-	dsz := len(data)
-	buf := new(bytes.Buffer)
+	if len(data) == 0 {
+		if cap(data) == 0 {
+			data = make([]byte, 0, 64)
+		}
+		data = append(data, '{')
+	} else {
+		// drop the closing brace
+		data = data[:len(data)-1]
+		if len(data) > 1 {
+			data = append(data, ',')
+		}
+	}
 
-	if dsz == 0 {
-		data = make([]byte, 0, 64)
-		data = append(data, '{', '}')
-		dsz = 2
+	data = append(data, '"')
+	data = append(data, key...)
+	data = append(data, '"', ':')
+	data = append(data, value...)
+	return append(data, '}')
+}
+
+// jsonValue decodes a json value produced by a rule into an expression value.
+// Returns an invalid value for nil or null values.
+func jsonValue(raw []byte) (v expr.Value) {
+	if len(raw) == 0 {
+		return v
 	}
 
-	if dsz > 2 {
-		buf.WriteByte(',')
+	switch raw[0] {
+	case '"':
+		if bytes.IndexByte(raw, '\\') < 0 {
+			return expr.Value{Kind: expr.String, Str: string(raw[1 : len(raw)-1])}
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return v
+		}
+		return expr.Value{Kind: expr.String, Str: s}
+
+	case 't', 'f':
+		return expr.Value{Kind: expr.Bool, Bool: raw[0] == 't'}
+
+	case 'n':
+		return v
 	}
 
-	buf.WriteByte('"')
-	buf.WriteString(key)
-	buf.WriteByte('"')
-	buf.WriteByte(':')
-	buf.Write(value)
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return v
+	}
+	return expr.Value{Kind: expr.Number, Num: f}
+}
 
-	return append(data[:dsz-1], append(buf.Bytes(), data[dsz-1:]...)...)
+// appendValue appends the json encoding of the expression value
+func appendValue(data []byte, v expr.Value) (newData []byte) {
+	switch v.Kind {
+	case expr.Number:
+		return strconv.AppendFloat(data, v.Num, 'f', -1, 64)
+	case expr.String:
+		return rule.AppendJSONString(data, v.Str)
+	case expr.Bool:
+		return strconv.AppendBool(data, v.Bool)
+	}
+	return append(data, "null"...)
 }
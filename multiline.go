@@ -0,0 +1,167 @@
+package rxde
+
+import (
+	"errors"
+	"regexp"
+)
+
+var (
+	errMultiline          = errors.New("multiline requires continue, indent or negate")
+	errMultilineNegate    = errors.New("multiline negate requires start_match")
+	errMultilineRegex     = errors.New("multiline is not supported with regex")
+	errMultilineTruncated = errors.New("multiline record truncated")
+)
+
+// Multiline config for joining continuation lines, like stack traces, into a single record.
+// Rules are evaluated once against the record lines joined by newlines, so their
+// regexes can match across lines using the (?s) and (?m) flags.
+type Multiline struct {
+	Continue string `json:"continue"`  // lines matching continue the current record
+	Indent   bool   `json:"indent"`    // lines starting with whitespace continue the current record
+	Negate   bool   `json:"negate"`    // lines not matching start_match continue the current record
+	MaxLines int    `json:"max_lines"` // maximum lines per record, excess lines are dropped
+	MaxBytes int    `json:"max_bytes"` // maximum bytes per record, excess lines are dropped
+}
+
+// compileMultiline validates the multiline config
+func (p *Parser) compileMultiline(config *Multiline) (err error) {
+	if config == nil {
+		return nil
+	}
+
+	if config.Continue == "" && !config.Indent && !config.Negate {
+		return errMultiline
+	}
+
+	if config.Negate && p.startMatch == nil {
+		return errMultilineNegate
+	}
+
+	if p.regex != nil {
+		return errMultilineRegex
+	}
+
+	if config.Continue != "" {
+		if p.continueMatch, err = regexp.Compile(config.Continue); err != nil {
+			return err
+		}
+	}
+
+	p.multiline = config
+	return nil
+}
+
+// continues returns true if the line continues the current record
+func (p *Parser) continues(line []byte) bool {
+	if p.continueMatch != nil && p.continueMatch.Match(line) {
+		return true
+	}
+
+	if p.multiline.Indent && (line[0] == ' ' || line[0] == '\t') {
+		return true
+	}
+
+	return p.multiline.Negate && !p.startMatch.Match(line)
+}
+
+func (p *Parser) parseMultiline(s *session) {
+
+	var skip int
+	var block []byte
+	var lines int
+	var blanks int // blank lines kept if the block continues after them
+	var truncated bool
+	rec := p.newRecord(s)
+	scanner := s.scanner
+
+	// flush evaluates the rules against the joined lines and emits the record
+	flush := func() (ok bool) {
+		if lines == 0 {
+			return true
+		}
+
+		for r := range p.rules {
+			value, ok, err := rec.parse(p.rules[r], block)
+			if err != nil {
+				rec.Errors = append(rec.Errors, err)
+				continue
+			}
+
+			if ok {
+				rec.set(r, p.rules[r].Config().Name, value)
+			}
+		}
+
+		if truncated {
+			rec.Errors = append(rec.Errors, errMultilineTruncated)
+		}
+
+		ok = true
+		if !rec.empty() {
+			ok = p.emit(rec, s)
+		}
+
+		rec.reset()
+		block = block[:0]
+		lines = 0
+		blanks = 0
+		truncated = false
+		return ok
+	}
+
+	for scanner.Scan() {
+		// The record ends when the input is idle
+		if scanner.idle {
+			if !flush() {
+				return
+			}
+			continue
+		}
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if lines > 0 {
+				blanks++
+			}
+			continue
+		}
+
+		if p.stop(s, line) {
+			break
+		}
+
+		if p.skip(&skip, line) {
+			continue
+		}
+
+		if lines > 0 && !p.continues(line) {
+			if !flush() {
+				return
+			}
+		}
+
+		p.updateSticky(s, line)
+		rec.touch(s)
+
+		if (p.multiline.MaxLines > 0 && lines+blanks >= p.multiline.MaxLines) ||
+			(p.multiline.MaxBytes > 0 && len(block)+blanks+len(line)+1 > p.multiline.MaxBytes && lines > 0) {
+			truncated = true
+			blanks = 0
+			continue
+		}
+
+		if lines > 0 {
+			block = append(block, '\n')
+		}
+		for ; blanks > 0; blanks-- {
+			block = append(block, '\n')
+			lines++
+		}
+		block = append(block, line...)
+		lines++
+	}
+
+	if flush() {
+		p.done(s)
+	}
+}
@@ -0,0 +1,197 @@
+package rxde
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Source of raw data for ParseAll
+type Source struct {
+	Name   string    // source name for errors
+	Reader io.Reader // raw data
+	Fields []Field   // fields added to every result of this source
+}
+
+// SourceProcessor is a callback to process each result of the source with the given index.
+// Return false to stop parsing all sources.
+type SourceProcessor func(source int, r Result) (ok bool)
+
+// SourceError is the error that ended parsing a source
+type SourceError struct {
+	Source int    // source index
+	Name   string // source name
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = "source " + strconv.Itoa(e.Source)
+	}
+	return name + ": " + e.Err.Error()
+}
+
+// Unwrap returns the source error
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// SourceErrors are the errors of the failed sources ordered by source index
+type SourceErrors []*SourceError
+
+func (e SourceErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strconv.Itoa(len(e)) + " sources failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the source errors
+func (e SourceErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
+
+// ParseAll parses the sources concurrently with up to workers goroutines, GOMAXPROCS when not
+// positive, delivering the results in order for each source but interleaved across sources.
+// The processor is never called concurrently. It returns the summary of each source and
+// ErrAborted if the processor returned false, the context error if it was done, SourceErrors
+// if any source failed with an input error, or nil.
+func (p *Parser) ParseAll(ctx context.Context, sources []Source, workers int, cb SourceProcessor) (sums []Summary, err error) {
+	return p.parseAll(ctx, sources, workers, cb, false)
+}
+
+// ParseAllOrdered parses the sources like ParseAll, delivering the results of each source after
+// the results of the previous sources. Results of sources ahead of the current one are buffered.
+func (p *Parser) ParseAllOrdered(ctx context.Context, sources []Source, workers int, cb SourceProcessor) (sums []Summary, err error) {
+	return p.parseAll(ctx, sources, workers, cb, true)
+}
+
+// sourceState holds the buffered results for ordered delivery
+type sourceState struct {
+	results []Result
+	done    bool
+}
+
+func (p *Parser) parseAll(ctx context.Context, sources []Source, workers int, cb SourceProcessor, ordered bool) (sums []Summary, err error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// stop only ends the dispatch of sources, sources being parsed stop
+	// when the processor call is refused and are parsed with the caller context
+	stop, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mtx sync.Mutex
+	var aborted bool
+	var current int // source delivered directly in ordered mode
+	states := make([]sourceState, len(sources))
+	errs := make([]error, len(sources))
+	sums = make([]Summary, len(sources))
+
+	// call delivers a result to the processor, aborting all sources when it returns false
+	call := func(i int, r Result) (ok bool) {
+		if aborted {
+			return false
+		}
+		if !cb(i, r) {
+			aborted = true
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	deliver := func(i int, r Result) (ok bool) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if ordered && i != current {
+			states[i].results = append(states[i].results, r)
+			return !aborted
+		}
+		return call(i, r)
+	}
+
+	// finish advances the current source delivering the buffered results
+	finish := func(i int) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		states[i].done = true
+		if !ordered || i != current {
+			return
+		}
+
+		for current++; current < len(sources); current++ {
+			for _, r := range states[current].results {
+				call(current, r)
+			}
+			states[current].results = nil
+
+			if !states[current].done {
+				return
+			}
+		}
+	}
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range sources {
+			select {
+			case indexes <- i:
+			case <-stop.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if stop.Err() != nil {
+					continue
+				}
+
+				sums[i], errs[i] = p.ParseWithContext(ctx, sources[i].Reader, func(r Result) (ok bool) {
+					return deliver(i, r)
+				}, sources[i].Fields...)
+				finish(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case aborted:
+		return sums, ErrAborted
+	case ctx.Err() != nil:
+		return sums, ctx.Err()
+	}
+
+	var failed SourceErrors
+	for i := range errs {
+		if errs[i] != nil && errs[i] != ErrStopMatch {
+			failed = append(failed, &SourceError{Source: i, Name: sources[i].Name, Err: errs[i]})
+		}
+	}
+
+	if failed != nil {
+		return sums, failed
+	}
+
+	return sums, nil
+}
@@ -0,0 +1,205 @@
+package rxde
+
+import (
+	"context"
+	"io"
+	"runtime"
+)
+
+// minChunkSize is the minimum size of the chunks parsed concurrently by ParseAt
+var minChunkSize int64 = 1 << 20
+
+// chunk alignment modes
+const (
+	alignNone  = iota // the input can't be split
+	alignLine         // chunks start at any line
+	alignStart        // chunks start at a start_match line
+	alignAfter        // chunks start after a blank or end_match line
+)
+
+// align returns how chunks of the input can be aligned so records never straddle them
+func (p *Parser) align() (mode int) {
+	// line numbers, state across lines and transformed inputs require a sequential scan
+	if p.config.LineField != "" || p.config.Decompress || p.config.Encoding != "" ||
+		p.splitter.regex != nil || p.skipMatch != nil || len(p.sticky) > 0 ||
+		p.multiline != nil || p.root != nil {
+		return alignNone
+	}
+
+	if p.regex != nil {
+		if p.startMatch != nil {
+			return alignNone
+		}
+		return alignLine
+	}
+
+	switch {
+	case p.config.RecordLines > 0:
+		return alignNone
+	case p.startMatch != nil:
+		return alignStart
+	case p.config.BlankLine || p.endMatch != nil:
+		return alignAfter
+	}
+
+	return alignNone
+}
+
+// boundary returns the aligned chunk start at or after the input offset,
+// or -1 when there is none before the end of the input
+func (p *Parser) boundary(r io.ReaderAt, size, offset int64, mode int) (start int64) {
+	config := p.config
+	config.FlushIdle = 0
+	sc := newLineScanner(context.Background(), io.NewSectionReader(r, offset, size-offset), &p.splitter, &config)
+
+	// skip the line containing the offset
+	if !sc.Scan() {
+		return -1
+	}
+
+	for {
+		start = offset + sc.consumed
+		if !sc.Scan() {
+			return -1
+		}
+
+		line := sc.Bytes()
+		switch mode {
+		case alignLine:
+			return start
+		case alignStart:
+			if p.startMatch.Match(line) {
+				return start
+			}
+		case alignAfter:
+			if (p.config.BlankLine && blank(line)) || (p.endMatch != nil && p.endMatch.Match(line)) {
+				if start = offset + sc.consumed; start < size {
+					return start
+				}
+				return -1
+			}
+		}
+	}
+}
+
+// chunkResult is the outcome of parsing a chunk
+type chunkResult struct {
+	results []Result
+	sum     Summary
+	err     error
+}
+
+// ParseAt parses the size bytes of a seekable input like ParseWithContext, splitting it into chunks
+// aligned on line boundaries that are parsed concurrently by up to workers goroutines, GOMAXPROCS
+// when not positive, and delivering the results in the input order. Chunks are aligned at any line
+// in line mode, and at start_match lines or after blank or end_match lines in record mode.
+// Inputs that can't be split, like with sticky rules, skip and resume matches, line numbers or
+// start_match in line mode, are parsed sequentially.
+func (p *Parser) ParseAt(ctx context.Context, r io.ReaderAt, size int64, workers int, cb Processor, fields ...Field) (sum Summary, err error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	mode := p.align()
+	chunkSize := size / int64(workers*4)
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	if mode == alignNone || workers == 1 || size <= chunkSize {
+		return p.ParseWithContext(ctx, io.NewSectionReader(r, 0, size), cb, fields...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// chunks in flight are bounded to limit buffered results
+	window := make(chan struct{}, workers*2)
+	type chunk struct {
+		start, end int64
+		done       chan chunkResult
+	}
+	chunks := make(chan chunk, workers*2)
+
+	// split the input into chunks
+	go func() {
+		defer close(chunks)
+		for start := int64(0); start >= 0 && start < size; {
+			end := int64(-1)
+			if start+chunkSize < size {
+				end = p.boundary(r, size, start+chunkSize, mode)
+			}
+			if end < 0 {
+				end = size
+			}
+
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			c := chunk{start: start, end: end, done: make(chan chunkResult, 1)}
+			chunks <- c
+			start = end
+		}
+	}()
+
+	// parse chunks concurrently keeping their order
+	ordered := make(chan chan chunkResult, workers*2)
+	work := make(chan chunk)
+	go func() {
+		defer close(ordered)
+		defer close(work)
+		for c := range chunks {
+			ordered <- c.done
+			select {
+			case work <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for c := range work {
+				var res chunkResult
+				res.sum, res.err = p.parseWithContext(ctx, io.NewSectionReader(r, c.start, c.end-c.start),
+					parseOptions{offset: c.start, chunk: true}, func(r Result) (ok bool) {
+						res.results = append(res.results, r)
+						return true
+					}, fields...)
+				c.done <- res
+			}
+		}()
+	}
+
+	// deliver the results in order
+	for done := range ordered {
+		var res chunkResult
+		select {
+		case res = <-done:
+		case <-ctx.Done():
+			return sum, ctx.Err()
+		}
+		<-window
+
+		for i := range res.results {
+			if !cb(res.results[i]) {
+				// the summary of a chunk is only known as a whole
+				return sum, ErrAborted
+			}
+		}
+		sum.Lines += res.sum.Lines
+		sum.Records += res.sum.Records
+		sum.Errors += res.sum.Errors
+		sum.Filtered += res.sum.Filtered
+
+		if res.err != nil {
+			return sum, res.err
+		}
+	}
+
+	return sum, ctx.Err()
+}
@@ -6,14 +6,16 @@ It intends to be as fast as possible and minimize allocations, despite using reg
 package rxde
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"regexp"
+	"sync/atomic"
+	"time"
 
+	"github.com/brunotm/rxde/expr"
 	"github.com/brunotm/rxde/rule"
 )
 
@@ -22,6 +24,12 @@ var (
 	errRepeatedRuleName     = errors.New("repeated rule name")
 	errInvalidParsersNumber = errors.New("invalid number of matches and parsers")
 	errNilStartRegex        = errors.New("both StartMatch and Regex are nil")
+
+	// ErrStopMatch is returned when parsing ends at a stop_match line
+	ErrStopMatch = errors.New("stop match")
+	// ErrAborted is returned when parsing ends by the processor returning false
+	ErrAborted    = errors.New("aborted by processor")
+	errSkipResume = errors.New("skip_match and resume_match must be set together")
 )
 
 // Result represents a json document and any errors from parsing and transformation
@@ -30,31 +38,138 @@ type Result struct {
 	Errors []error
 }
 
+// Summary of a single parse call
+type Summary struct {
+	Lines    uint64 // input lines read
+	Records  uint64 // records delivered to the processor
+	Errors   uint64 // records delivered with errors
+	Filtered uint64 // records dropped by the filter
+}
+
+// Stats are the parser counters since its creation, cumulative across
+// all parse calls and goroutines using the parser
+type Stats struct {
+	Records  uint64 // records delivered to processors
+	Errors   uint64 // records delivered with errors
+	Filtered uint64 // records dropped by the filter
+}
+
 // Config for creating a parser
 type Config struct {
-	FindAll     bool          `json:"find_all"`     // find all ocurrences of the parser regex
-	StartMatch  string        `json:"start_match"`  // start matching when matched (inclusive current line)
-	StopMatch   string        `json:"stop_match"`   // stop matching when matched (terminates parsing)
-	SkipMatch   string        `json:"skip_match"`   // skip lines when matched, until resume_match
-	ResumeMatch string        `json:"resume_match"` // resume after skiping when matched
-	Regex       string        `json:"regex"`        // regex to use when performing line oriented matching
-	Rules       []rule.Config `json:"rules"`        // rules for parse and extract data
+	FindAll         bool          `json:"find_all"`         // find all ocurrences of the parser regex
+	StartMatch      string        `json:"start_match"`      // start matching when matched (inclusive current line)
+	StopMatch       string        `json:"stop_match"`       // stop matching when matched (terminates parsing)
+	SkipMatch       string        `json:"skip_match"`       // skip lines when matched, until resume_match
+	ResumeMatch     string        `json:"resume_match"`     // resume after skiping when matched
+	SkipExclusive   bool          `json:"skip_exclusive"`   // parse the skip_match line that starts a skipped region
+	ResumeInclusive bool          `json:"resume_inclusive"` // skip the resume_match line that ends a skipped region
+	Regex           string        `json:"regex"`            // regex to use when performing line oriented matching
+	Rules           []rule.Config `json:"rules"`            // rules for parse and extract data
+	Sticky          []rule.Config `json:"sticky"`           // rules whose last matched value is added to every following result
+	Derived         []Derived     `json:"derived"`          // fields computed from other fields when a record is complete
+	Filter          string        `json:"filter"`           // expression records must satisfy to be delivered
+	Multiline       *Multiline    `json:"multiline"`        // join continuation lines into a single record
+
+	EndMatch     string   `json:"end_match"`     // end the current record when matched (inclusive current line)
+	EndExclusive bool     `json:"end_exclusive"` // exclude the end_match line from the record
+	BlankLine    bool     `json:"blank_line"`    // end the current record on blank lines
+	RecordLines  int      `json:"record_lines"`  // end the current record after this number of lines
+	FlushIdle    Duration `json:"flush_idle"`    // end the current record when no line is read for this duration
+	FlushBlocked bool     `json:"flush_blocked"` // end the current record when a Follower source waits for new data
+
+	States     []State `json:"states"`      // nested sections parsed with a state machine
+	StateField string  `json:"state_field"` // field for the state path of each result
+
+	Decompress    bool      `json:"decompress"`      // decompress gzip, bzip2, xz and zstd input, see Decompress
+	Encoding      Encoding  `json:"encoding"`        // input encoding transcoded to UTF-8
+	Split         Split     `json:"split"`           // line terminator: newline, crlf, cr, nul, bytes or regex
+	Separator     string    `json:"separator"`       // separator for the bytes and regex splits
+	MaxLineBytes  int       `json:"max_line_bytes"`  // maximum line length, 64KiB when not set
+	LongLines     LongLines `json:"long_lines"`      // policy for longer lines: truncate, skip or split
+	CloseOnCancel bool      `json:"close_on_cancel"` // also close io.Closer input when the parse context is done, ending abandoned reads
+
+	Fields      map[string]interface{} `json:"fields"`       // static fields added to every result
+	LineField   string                 `json:"line_field"`   // field for the [first, last] input line numbers of each result
+	OffsetField string                 `json:"offset_field"` // field for the input byte offset of each result
+	TimeField   string                 `json:"time_field"`   // field for the parse timestamp of each result
 }
 
-// Parser type. A parser has no state and is safe for concurrent use
+// Parser type. A parser has no state besides its stats, atomic counters shared
+// by all parse calls, and is safe for concurrent use
 type Parser struct {
-	startMatch  *regexp.Regexp
-	stopMatch   *regexp.Regexp
-	skipMatch   *regexp.Regexp
-	resumeMatch *regexp.Regexp
-	regex       *regexp.Regexp
-	rules       []*rule.Rule
-	config      Config
+	records       uint64 // stats, first for 64-bit alignment
+	errors        uint64
+	filtered      uint64
+	startMatch    *regexp.Regexp
+	stopMatch     *regexp.Regexp
+	endMatch      *regexp.Regexp
+	skipMatch     *regexp.Regexp
+	resumeMatch   *regexp.Regexp
+	regex         *regexp.Regexp
+	multiline     *Multiline
+	continueMatch *regexp.Regexp
+	splitter      splitter
+	root          *state // root of the state machine
+	rules         []*rule.Rule
+	prefilter     *prefilter // literal prefilter for the rules, nil without literals
+	sticky        []*rule.Rule
+	derived       []derived    // derived fields in evaluation order
+	fields        []expr.Field // expression fields, rules followed by sticky and derived fields
+	filter        *expr.Expr
+	static        []field             // encoded static fields
+	names         map[string]struct{} // field names in use
+	clock         func() time.Time    // reference clock for time fields, time.Now when nil
+	config        Config
+}
+
+// record being parsed
+type record struct {
+	Result
+	values  [][]byte     // rule values by rule index, followed by sticky values
+	matched []uint64     // bitset of rules that matched by rule index
+	match   [][]byte     // line regex submatches
+	buf     []byte       // storage for rule values
+	exprs   []expr.Value // expression values by field index
+	lines   int          // number of input lines
+	first   int64        // first input line
+	last    int64        // last input line
+	offset  int64        // input byte offset
+	end     int64        // input byte offset after the last line
+	reuse   bool         // reuse the result buffers after delivery
+}
+
+// session holds the state of a single parse call
+type session struct {
+	cb      Processor
+	scanner *lineScanner
+	fields  []field  // encoded per call fields
+	sticky  [][]byte // last sticky rule values
+	errors  []error  // sticky rule and checkpoint errors pending delivery
+
+	checkpoint checkpointer // source persisting the offset of delivered records
+	summary    Summary
+	stopped    bool // ended at a stop match
+	aborted    bool // ended by the processor
+	reuse      bool // reuse result buffers across records
+}
+
+// Option for creating a parser
+type Option func(p *Parser)
+
+// WithClock sets the reference clock for the time field and the rules of the parser,
+// used for relative times and timestamps without a year, defaults to time.Now
+func WithClock(clock func() time.Time) Option {
+	return func(p *Parser) {
+		p.clock = clock
+	}
 }
 
-// New creates a new parser with the given config
-func New(config Config) (p *Parser, err error) {
+// New creates a new parser with the given config and options
+func New(config Config, opts ...Option) (p *Parser, err error) {
 	p = &Parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
 	p.config = config
 
 	if config.StartMatch != "" {
@@ -71,6 +186,13 @@ func New(config Config) (p *Parser, err error) {
 		}
 	}
 
+	if config.EndMatch != "" {
+		p.endMatch, err = regexp.Compile(config.EndMatch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if config.SkipMatch != "" {
 		p.skipMatch, err = regexp.Compile(config.SkipMatch)
 		if err != nil {
@@ -79,20 +201,36 @@ func New(config Config) (p *Parser, err error) {
 	}
 
 	if config.ResumeMatch != "" {
-		p.stopMatch, err = regexp.Compile(config.ResumeMatch)
+		p.resumeMatch, err = regexp.Compile(config.ResumeMatch)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if config.Regex != "" {
-		p.stopMatch, err = regexp.Compile(config.Regex)
+		p.regex, err = regexp.Compile(config.Regex)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if len(config.Rules) == 0 {
+	if err = validEncoding(config.Encoding); err != nil {
+		return nil, err
+	}
+
+	if p.splitter, err = compileSplit(config.Split, config.Separator); err != nil {
+		return nil, err
+	}
+
+	if err = validLongLines(config.LongLines); err != nil {
+		return nil, err
+	}
+
+	if (p.skipMatch == nil) != (p.resumeMatch == nil) {
+		return nil, errSkipResume
+	}
+
+	if len(config.Rules) == 0 && len(config.States) == 0 {
 		return nil, errEmptyRules
 	}
 
@@ -106,14 +244,54 @@ func New(config Config) (p *Parser, err error) {
 		}
 		ruleNames[config.Rules[i].Name] = struct{}{}
 
-		r, err := rule.New(config.Rules[i])
+		r, err := rule.New(config.Rules[i], rule.WithClock(p.clock))
 		if err != nil {
 			return nil, err
 		}
 		p.rules = append(p.rules, r)
 	}
+	p.prefilter = newPrefilter(p.rules)
+
+	for i := range config.Sticky {
+		if _, ok := ruleNames[config.Sticky[i].Name]; ok {
+			return nil, errRepeatedRuleName
+		}
+		ruleNames[config.Sticky[i].Name] = struct{}{}
+
+		r, err := rule.New(config.Sticky[i], rule.WithClock(p.clock))
+		if err != nil {
+			return nil, err
+		}
+		p.sticky = append(p.sticky, r)
+	}
+
+	if err = p.compileMultiline(config.Multiline); err != nil {
+		return nil, err
+	}
+
+	if err = p.compileStates(config.States, ruleNames); err != nil {
+		return nil, err
+	}
 
-	if p.regex == nil && p.startMatch == nil {
+	if err = p.compileDerived(config.Derived, ruleNames); err != nil {
+		return nil, err
+	}
+
+	if err = p.compileFilter(config.Filter); err != nil {
+		return nil, err
+	}
+
+	if p.static, err = encodeFields(config.Fields, ruleNames); err != nil {
+		return nil, err
+	}
+
+	if err = metaNames(config, ruleNames); err != nil {
+		return nil, err
+	}
+	p.names = ruleNames
+
+	if p.regex == nil && p.startMatch == nil && p.multiline == nil && p.root == nil &&
+		p.endMatch == nil && !config.BlankLine && config.RecordLines <= 0 {
 		return nil, errNilStartRegex
 	}
 
@@ -125,30 +303,34 @@ func (p *Parser) Config() (c Config) {
 	return p.config
 }
 
+// Stats returns the parser counters. Counters are updated as each record is delivered
+// and include all calls on this parser, use the Summary of a parse call for its own counts.
+func (p *Parser) Stats() (s Stats) {
+	s.Records = atomic.LoadUint64(&p.records)
+	s.Errors = atomic.LoadUint64(&p.errors)
+	s.Filtered = atomic.LoadUint64(&p.filtered)
+	return s
+}
+
 // MarshalJSON creates a json config from this parser
 func (p *Parser) MarshalJSON() (data []byte, err error) {
 	return json.Marshal(&p.config)
 }
 
-// UnmarshalJSON creates a new parser from the JSON encoded configuration
+// UnmarshalJSON creates a new parser from the JSON encoded configuration, resetting its stats
+// and keeping its clock
 func (p *Parser) UnmarshalJSON(data []byte) (err error) {
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
 		return err
 	}
 
-	pp, err := New(config)
+	pp, err := New(config, WithClock(p.clock))
 	if err != nil {
 		return err
 	}
 
-	p.startMatch = pp.startMatch
-	p.stopMatch = pp.stopMatch
-	p.skipMatch = pp.skipMatch
-	p.resumeMatch = pp.resumeMatch
-	p.regex = pp.regex
-	p.rules = pp.rules
-	p.config = config
+	*p = *pp
 
 	return nil
 }
@@ -157,80 +339,334 @@ func (p *Parser) UnmarshalJSON(data []byte) (err error) {
 // Return false to stop parsing.
 type Processor func(r Result) (ok bool)
 
-// Parse parses raw data in its own goroutine returning the parsed results in the results chan
-func (p *Parser) Parse(ctx context.Context, data io.Reader) (results <-chan Result) {
-	res := make(chan Result)
+// Parse parses raw data in its own goroutine returning the parsed results in the results chan.
+// The given fields are added to every result. Parsing ends when the context is done as in ParseWithContext.
+func (p *Parser) Parse(ctx context.Context, data io.Reader, fields ...Field) (results <-chan Result) {
+	return p.ParseStream(ctx, data, fields...).Results()
+}
 
-	go func() {
-		p.ParseWith(data, func(r Result) (ok bool) {
+// Stream of results parsed in its own goroutine
+type Stream struct {
+	results chan Result
+	summary Summary
+	err     error
+}
+
+// Results returns the results chan, closed when parsing ends
+func (st *Stream) Results() (results <-chan Result) {
+	return st.results
+}
+
+// Err returns why parsing ended as in ParseWithContext, once the results chan is closed
+func (st *Stream) Err() (err error) {
+	return st.err
+}
+
+// Summary returns the parse summary, once the results chan is closed
+func (st *Stream) Summary() (sum Summary) {
+	return st.summary
+}
+
+// ParseStream parses raw data in its own goroutine like Parse, returning a stream
+// that exposes the summary and why parsing ended after its results chan is closed.
+func (p *Parser) ParseStream(ctx context.Context, data io.Reader, fields ...Field) (st *Stream) {
+	return p.ParseBuffered(ctx, data, 0, fields...)
+}
+
+// ParseWith parses raw data using the specified processor to handle parsed results.
+// The given fields are added to every result.
+func (p *Parser) ParseWith(data io.Reader, cb Processor, fields ...Field) {
+	p.ParseWithContext(context.Background(), data, cb, fields...)
+}
+
+// ParseWithContext parses raw data like ParseWith until the end of the input, a stop match,
+// the processor returns false or the context is done, returning a summary and why parsing
+// ended: nil at the end of the input, ErrStopMatch, ErrAborted, the context error or the
+// input error. With a cancellable context lines are read by a separate goroutine and
+// a read blocked on cancellation is abandoned, or also closed when the input is an
+// io.Closer and CloseOnCancel is set.
+func (p *Parser) ParseWithContext(ctx context.Context, data io.Reader, cb Processor, fields ...Field) (sum Summary, err error) {
+	return p.parseWithContext(ctx, data, parseOptions{}, cb, fields...)
+}
+
+// ParseWithReuse parses raw data like ParseWithContext reusing the result buffers across
+// records to avoid allocations. Result Data and Errors are only valid during the processor
+// call and must be copied to be retained.
+func (p *Parser) ParseWithReuse(ctx context.Context, data io.Reader, cb Processor, fields ...Field) (sum Summary, err error) {
+	return p.parseWithContext(ctx, data, parseOptions{reuse: true}, cb, fields...)
+}
+
+// parseOptions for parsing part of an input or reusing result buffers
+type parseOptions struct {
+	offset int64 // input offset of the data
+	reuse  bool  // reuse result buffers across records
+	chunk  bool  // a ParseAt chunk, records never end on idle input
+}
+
+// parseWithContext parses raw data with the given options
+func (p *Parser) parseWithContext(ctx context.Context, data io.Reader, opts parseOptions, cb Processor, fields ...Field) (sum Summary, err error) {
+
+	s := &session{cb: cb, sticky: make([][]byte, len(p.sticky)), reuse: opts.reuse}
+
+	if s.fields, err = p.encodeCallFields(fields); err != nil {
+		cb(Result{Errors: []error{err}})
+		return sum, err
+	}
+
+	// checkpoint offsets are only valid for the raw input
+	if c, ok := data.(checkpointer); ok && !p.config.Decompress && p.config.Encoding == "" {
+		s.checkpoint = c
+	}
+
+	source := data
+	if p.config.Decompress {
+		if data, err = Decompress(data); err != nil {
+			cb(Result{Errors: []error{err}})
+			return sum, err
+		}
+	}
+
+	s.scanner = newLineScanner(ctx, newDecoder(data, p.config.Encoding), &p.splitter, &p.config)
+	s.scanner.consumed = opts.offset
+	if opts.chunk {
+		s.scanner.timeout = 0
+	}
+	if w, ok := source.(waiter); ok && p.config.FlushBlocked {
+		s.scanner.wait = w.waiting()
+	}
+	defer s.scanner.close()
+
+	// end reads blocked on cancellation by closing the input
+	if c, ok := source.(io.Closer); ok && p.config.CloseOnCancel && ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
 			select {
-			case res <- r:
-				return true
 			case <-ctx.Done():
-				return false
+				c.Close()
+			case <-stop:
 			}
-		})
-		close(res)
-	}()
+		}()
+	}
 
-	return res
+	switch {
+	case p.root != nil:
+		p.parseStates(s)
+	case p.multiline != nil:
+		p.parseMultiline(s)
+	case p.regex == nil:
+		p.parseSet(s)
+	default:
+		p.parse(s)
+	}
+
+	sum = s.summary
+	sum.Lines = uint64(s.scanner.line)
+
+	switch {
+	case s.scanner.ctxErr != nil:
+		return sum, s.scanner.ctxErr
+	case s.aborted && ctx.Err() != nil:
+		// processors like in Parse abort when the context is done
+		return sum, ctx.Err()
+	case s.aborted:
+		return sum, ErrAborted
+	case s.scanner.Err() != nil:
+		return sum, s.scanner.Err()
+	case s.stopped:
+		return sum, ErrStopMatch
+	}
+
+	return sum, nil
 }
 
-// ParseWith parses raw data using the specified processor to handle parsed results
-func (p *Parser) ParseWith(data io.Reader, cb Processor) {
+// newRecord creates an empty record for this parser
+func (p *Parser) newRecord(s *session) (rec *record) {
+	return &record{
+		values:  make([][]byte, len(p.rules)+len(p.sticky)),
+		matched: make([]uint64, (len(p.rules)+63)/64),
+		exprs:   make([]expr.Value, len(p.fields)),
+		reuse:   s.reuse,
+	}
+}
 
-	if p.regex == nil {
-		p.parseSet(data, cb)
-		return
+// reset the record for reuse. Previously delivered results are not modified
+// unless the record reuses its result buffers.
+func (rec *record) reset() {
+	if rec.reuse {
+		rec.Data = rec.Data[:0]
+		rec.Errors = rec.Errors[:0]
+	} else {
+		rec.Result = Result{}
+	}
+	rec.lines = 0
+	rec.first = 0
+	rec.buf = rec.buf[:0]
+	for i := range rec.values {
+		rec.values[i] = nil
+	}
+	for i := range rec.matched {
+		rec.matched[i] = 0
 	}
+}
+
+// empty returns true if the record has no data or errors
+func (rec *record) empty() bool {
+	return len(rec.Data) == 0 && len(rec.Errors) == 0
+}
 
-	p.parse(data, cb)
-	return
+// has returns true if the rule at index matched
+func (rec *record) has(index int) bool {
+	return hasBit(rec.matched, index)
+}
+
+// set the value for the rule at index
+func (rec *record) set(index int, name string, value []byte) {
+	rec.values[index] = value
+	setBit(rec.matched, index)
+	rec.Data = appendJSON(rec.Data, name, value)
+}
 
+// parse evaluates the rule against data storing its value in the record buffer
+func (rec *record) parse(r *rule.Rule, data []byte) (value []byte, ok bool, err error) {
+	n := len(rec.buf)
+	rec.buf, ok, err = r.AppendParse(rec.buf, data)
+	if len(rec.buf) > n {
+		value = rec.buf[n:len(rec.buf):len(rec.buf)]
+	}
+	return value, ok, err
 }
 
-func (p *Parser) parse(data io.Reader, cb Processor) {
+// submatch slices the line at the given submatch index pairs into the record
+// submatches like regexp.FindSubmatch, returning nil when there's no match
+func (rec *record) submatch(line []byte, index []int) (match [][]byte) {
+	if index == nil {
+		return nil
+	}
 
-	var skip bool
+	match = rec.match[:0]
+	for i := 0; i < len(index); i += 2 {
+		if index[i] < 0 {
+			match = append(match, nil)
+			continue
+		}
+		match = append(match, line[index[i]:index[i+1]:index[i+1]])
+	}
+	rec.match = match
+	return match
+}
+
+// touch adds the current scanner line to the record line range,
+// taking the current sticky values when the record starts
+func (rec *record) touch(s *session) {
+	if rec.first == 0 {
+		rec.first = s.scanner.line
+		rec.offset = s.scanner.offset
+		copy(rec.values[len(rec.values)-len(s.sticky):], s.sticky)
+	}
+	rec.lines++
+	rec.last = s.scanner.line
+	rec.end = s.scanner.consumed
+}
+
+// flush emits the record if not empty and resets it
+func (p *Parser) flush(rec *record, s *session) (ok bool) {
+	ok = true
+	if !rec.empty() {
+		ok = p.emit(rec, s)
+	}
+	rec.reset()
+	return ok
+}
+
+// emit completes the record and delivers its result to the processor
+// if it satisfies the filter
+func (p *Parser) emit(rec *record, s *session) (ok bool) {
+	if s.scanner.cancelled() {
+		return false
+	}
+
+	p.injectSticky(rec, s)
+
+	if len(p.derived) > 0 || p.filter != nil {
+		for i := range rec.values {
+			rec.exprs[i] = jsonValue(rec.values[i])
+		}
+		p.derive(rec)
+
+		if !p.match(rec) {
+			atomic.AddUint64(&p.filtered, 1)
+			s.summary.Filtered++
+			return true
+		}
+	}
+
+	p.enrich(rec, s)
+
+	atomic.AddUint64(&p.records, 1)
+	s.summary.Records++
+	result := rec.Result
+	if len(result.Errors) == 0 {
+		result.Errors = nil
+	} else {
+		atomic.AddUint64(&p.errors, 1)
+		s.summary.Errors++
+	}
+
+	if !s.cb(result) {
+		s.aborted = true
+		return false
+	}
+
+	if s.checkpoint != nil {
+		if err := s.checkpoint.checkpoint(rec.end); err != nil {
+			s.errors = append(s.errors, err)
+		}
+	}
+
+	return true
+}
+
+func (p *Parser) parse(s *session) {
+
+	var skip int
 	var line []byte
+	started := p.startMatch == nil
 	var match [][]byte
 	var result Result
-	scanner := bufio.NewScanner(data)
+	rec := p.newRecord(s)
+	scanner := s.scanner
 
 	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			result = Result{}
-			result.Errors = append(result.Errors, err)
-			cb(result)
-			return
+		if scanner.idle {
+			continue
 		}
 
 		line = scanner.Bytes()
 
-		if p.stopMatch != nil && p.stopMatch.Match(line) {
-			break
+		// lines before the start match are ignored
+		if !started {
+			if !p.startMatch.Match(line) {
+				continue
+			}
+			started = true
 		}
 
-		// Only skip sections if both skip and continue regexps are set
-		if p.skipMatch != nil && p.resumeMatch != nil {
-			// Set the skip flag if skipMatch is set and match the current line
-			if p.skipMatch.Match(line) {
-				skip = true
-			}
-			//  Set the skip flag if resumeMatch is set and match the current line
-			if p.resumeMatch.Match(line) {
-				skip = false
-			}
+		if p.stop(s, line) {
+			break
+		}
 
-			if skip {
-				continue
-			}
+		if p.skip(&skip, line) {
+			continue
 		}
 
+		p.updateSticky(s, line)
+
 		if p.config.FindAll {
 			match = p.handleAllSubmatch(line)
 		} else {
-			match = p.regex.FindSubmatch(line)
+			match = rec.submatch(line, p.regex.FindSubmatchIndex(line))
 		}
 
 		if match == nil {
@@ -241,105 +677,179 @@ func (p *Parser) parse(data io.Reader, cb Processor) {
 		if len(match) != len(p.rules) {
 			result = Result{}
 			result.Errors = append(result.Errors, errInvalidParsersNumber)
-			if !cb(result) {
+			if !s.cb(result) {
+				s.aborted = true
 				return
 			}
 			continue
 		}
 
-		result = Result{}
+		rec.reset()
+		rec.touch(s)
 
 		for r := range p.rules {
 
-			value, _, err := p.rules[r].Parse(match[r])
+			value, _, err := rec.parse(p.rules[r], match[r])
 			if err != nil {
-				result.Errors = append(result.Errors, err)
+				rec.Errors = append(rec.Errors, err)
 			}
 
-			result.Data = appendJSON(result.Data, p.rules[r].Config().Name, value)
+			rec.set(r, p.rules[r].Config().Name, value)
 		}
 
-		if !cb(result) {
+		if !p.emit(rec, s) {
 			return
 		}
 	}
 
+	p.done(s)
 }
 
-func (p *Parser) parseSet(data io.Reader, cb Processor) {
+func (p *Parser) parseSet(s *session) {
 
-	var skip bool
-	var result Result
-	scanner := bufio.NewScanner(data)
+	var skip int
+	var candidates []uint64
+	rec := p.newRecord(s)
+	scanner := s.scanner
+
+	if p.prefilter != nil {
+		candidates = make([]uint64, len(rec.matched))
+	}
 
 	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			result = Result{}
-			result.Errors = append(result.Errors, err)
-			cb(result)
-			return
+		// The record ends when the input is idle
+		if scanner.idle {
+			if !p.flush(rec, s) {
+				return
+			}
+			continue
 		}
 
 		line := scanner.Bytes()
-		if len(line) == 0 {
+		if len(line) == 0 || (p.config.BlankLine && blank(line)) {
+			// Blank lines delimit records outside skipped sections
+			if p.config.BlankLine && skip == 0 && !p.flush(rec, s) {
+				return
+			}
 			continue
 		}
 
-		if p.stopMatch != nil && p.stopMatch.Match(line) {
+		if p.stop(s, line) {
 			break
 		}
 
-		// Only skip sections if both skip and continue regexps are set
-		if p.skipMatch != nil && p.resumeMatch != nil {
-			// Set the skip flag if skipMatch is set and match the current line
-			if p.skipMatch.Match(line) {
-				skip = true
-			}
-			//  Set the skip flag if resumeMatch is set and match the current line
-			if p.resumeMatch.Match(line) {
-				skip = false
-			}
-
-			if skip {
-				continue
-			}
+		if p.skip(&skip, line) {
+			continue
 		}
 
 		// If content is a match for startMatch and
 		// document is valid deliver the result
-		if p.startMatch.Match(line) {
-			if result.Data != nil || result.Errors != nil {
-				if !cb(result) {
-					return
-				}
+		if p.startMatch != nil && p.startMatch.Match(line) {
+			if !p.flush(rec, s) {
+				return
 			}
-			result = Result{}
 		}
 
-		for r := range p.rules {
+		end := p.endMatch != nil && p.endMatch.Match(line)
+		if end && p.config.EndExclusive {
+			if !p.flush(rec, s) {
+				return
+			}
+			continue
+		}
+
+		p.updateSticky(s, line)
+		rec.touch(s)
 
-			if bytes.Index(result.Data, []byte(p.rules[r].Config().Name)) > -1 {
+		// Only evaluate the rules whose literals are in the line
+		if candidates != nil {
+			p.prefilter.match(line, candidates)
+		}
+
+		for r := range p.rules {
+			// Rules are matched once per record
+			if rec.has(r) || (candidates != nil && !hasBit(candidates, r)) {
 				continue
 			}
 
 			// Continue if we don't match this regexp
-			value, ok, err := p.rules[r].Parse(line)
+			value, ok, err := rec.parse(p.rules[r], line)
 			if err != nil {
-				result.Errors = append(result.Errors, err)
+				rec.Errors = append(rec.Errors, err)
 				continue
 			}
 
 			if ok {
-				result.Data = appendJSON(result.Data, p.rules[r].Config().Name, value)
+				rec.set(r, p.rules[r].Config().Name, value)
 			}
 		}
-	}
 
-	if result.Data != nil || result.Errors != nil {
-		if !cb(result) {
-			return
+		// End the record if matched endMatch or reached the record lines
+		if end || (p.config.RecordLines > 0 && rec.lines == p.config.RecordLines) {
+			if !p.flush(rec, s) {
+				return
+			}
 		}
 	}
+
+	if p.flush(rec, s) {
+		p.done(s)
+	}
+}
+
+// blank returns true if the line is empty or has only whitespace
+func blank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+// stop returns true if the line matches the stop match, ending parsing
+func (p *Parser) stop(s *session, line []byte) bool {
+	if p.stopMatch != nil && p.stopMatch.Match(line) {
+		s.stopped = true
+		return true
+	}
+	return false
+}
+
+// done delivers the errors pending at the end of the input and the scanner error
+func (p *Parser) done(s *session) {
+	if s.scanner.ctxErr != nil {
+		return
+	}
+
+	var result Result
+	result.Errors = append(result.Errors, s.errors...)
+	result.Errors = append(result.Errors, s.scanner.pending()...)
+	if err := s.scanner.Err(); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+
+	if result.Errors != nil {
+		s.cb(result)
+	}
+}
+
+// skip updates the skip depth with the line, returning true if it must be skipped.
+// Skipped regions nest, each skip_match line opens a region closed by a resume_match
+// line and parsing resumes when the outermost region is closed. When the skip
+// depth is not zero a line matching resume_match closes a region before it's
+// checked against skip_match, so both regexes can be the same toggle.
+func (p *Parser) skip(depth *int, line []byte) bool {
+	if p.skipMatch == nil {
+		return false
+	}
+
+	if *depth > 0 && p.resumeMatch.Match(line) {
+		*depth--
+		return *depth > 0 || p.config.ResumeInclusive
+	}
+
+	if p.skipMatch.Match(line) {
+		*depth++
+		return *depth > 1 || !p.config.SkipExclusive
+	}
+
+	return *depth > 0
 }
 
 func (p *Parser) handleAllSubmatch(data []byte) (match [][]byte) {
@@ -1,9 +1,22 @@
 package rxde
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf16"
 
 	"github.com/brunotm/rxde/rule"
 )
@@ -63,6 +76,60 @@ func TestMarshalUnmarshal(t *testing.T) {
 	}
 }
 
+func TestDurationJSON(t *testing.T) {
+	p := &Parser{}
+	if err := p.UnmarshalJSON([]byte(`{"regex": "(.*)", "rules": [{"name": "line", "type": "string"}],
+		"flush_idle": "5s"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Config().FlushIdle != Duration(5*time.Second) {
+		t.Fatal("not equal: ", p.Config().FlushIdle, Duration(5*time.Second))
+	}
+
+	data, err := p.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(data, []byte(`"flush_idle":"5s"`)) {
+		t.Fatal("invalid flush_idle: ", string(data))
+	}
+
+	pp := &Parser{}
+	if err = pp.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if pp.Config().FlushIdle != p.Config().FlushIdle {
+		t.Fatal("not equal: ", pp.Config().FlushIdle, p.Config().FlushIdle)
+	}
+
+	var batch BatchConfig
+	if err = json.Unmarshal([]byte(`{"size": 10, "latency": "20ms"}`), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if batch.Latency != Duration(20*time.Millisecond) {
+		t.Fatal("not equal: ", batch.Latency, Duration(20*time.Millisecond))
+	}
+
+	var follow FollowConfig
+	if err = json.Unmarshal([]byte(`{"interval": "1m30s", "poll": 250000000}`), &follow); err != nil {
+		t.Fatal(err)
+	}
+
+	if follow.Interval != Duration(90*time.Second) || follow.Poll != Duration(250*time.Millisecond) {
+		t.Fatal("not equal: ", follow.Interval, follow.Poll)
+	}
+
+	for _, invalid := range []string{`{"poll": "5 parsecs"}`, `{"poll": true}`, `{"poll": 1.5}`} {
+		if err = json.Unmarshal([]byte(invalid), &follow); err == nil {
+			t.Fatal("accepted invalid duration: ", invalid)
+		}
+	}
+}
+
 func TestNewRepeatedRuleName(t *testing.T) {
 	_, err := New(Config{
 		StartMatch: "xxx",
@@ -139,3 +206,1881 @@ func BenchmarkParseWith(b *testing.B) {
 	}
 
 }
+
+var memData = []byte(`
+	197960064 K total memory
+	112675296 K used memory
+	197960064 K total memory
+	0 K used memory
+	`)
+
+func TestDerived(t *testing.T) {
+	p, err := New(Config{
+		StartMatch: "total memory",
+		Rules: []rule.Config{
+			{Name: "total", Type: "datasize", To: "kb", Regex: `(\d+ \w) total memory`},
+			{Name: "used", Type: "datasize", To: "kb", Regex: `(\d+ \w) used memory`},
+		},
+		Derived: []Derived{
+			{Name: "used_pct", Expr: "round(used / total * 100)"},
+			{Name: "free", Expr: "total - used"},
+			{Name: "state", Expr: `used_pct > 50 ? "high" : "low"`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`{"total":197960064,"used":112675296,"used_pct":57,"free":85284768,"state":"high"}`,
+		`{"total":197960064,"used":0,"used_pct":0,"free":197960064,"state":"low"}`,
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(memData), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if results[i].Errors != nil {
+			t.Fatal(results[i].Errors)
+		}
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+}
+
+func TestDerivedInvalid(t *testing.T) {
+	derived := [][]Derived{
+		{{Name: "a", Expr: "b + 1"}, {Name: "b", Expr: "a + 1"}},
+		{{Name: "a", Expr: "unknown + 1"}},
+		{{Name: "a", Expr: "name * 2"}},
+		{{Name: "name", Expr: "1"}},
+	}
+
+	for i := range derived {
+		_, err := New(Config{
+			StartMatch: "xxx",
+			Rules:      []rule.Config{{Name: "name", Type: "string"}},
+			Derived:    derived[i],
+		})
+		if err == nil {
+			t.Fatal("accepted invalid derived fields: ", derived[i])
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p, err := New(Config{
+		StartMatch: "total memory",
+		Rules: []rule.Config{
+			{Name: "total", Type: "datasize", To: "kb", Regex: `(\d+ \w) total memory`},
+			{Name: "used", Type: "datasize", To: "kb", Regex: `(\d+ \w) used memory`},
+		},
+		Derived: []Derived{{Name: "used_pct", Expr: "used / total * 100"}},
+		Filter:  "used_pct > 50",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(memData), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != 1 {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	if s := p.Stats(); s.Records != 1 || s.Filtered != 1 || s.Errors != 0 {
+		t.Fatal("invalid stats: ", s)
+	}
+
+	for _, filter := range []string{"unknown > 1", "used_pct + 1", "used_pct >"} {
+		_, err = New(Config{StartMatch: "xxx", Rules: []rule.Config{{Name: "used_pct", Type: "number"}}, Filter: filter})
+		if err == nil {
+			t.Fatal("accepted invalid filter: ", filter)
+		}
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	config := []byte(`{"regex": "^at (.*)$", "time_field": "parsed_at",
+		"rules": [{"name": "at", "type": "reltime", "to": "rfc3339"}],
+		"sticky": [{"name": "since", "type": "reltime", "to": "rfc3339", "regex": "since (.*)"}]}`)
+
+	p, err := New(Config{Regex: `^(.*)$`, Rules: []rule.Config{{Name: "line", Type: rule.String}}},
+		WithClock(func() time.Time { return time.Date(2018, 9, 19, 6, 46, 24, 0, time.UTC) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock is kept when unmarshaling a config
+	if err = p.UnmarshalJSON(config); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `{"at":"2018-09-19T03:46:24Z","since":"2018-09-17T06:46:24Z","parsed_at":"2018-09-19T06:46:24Z"}`
+
+	var results []string
+	p.ParseWith(strings.NewReader("since 2 days ago\nat 3 hours ago\n"), func(r Result) (ok bool) {
+		results = append(results, string(r.Data))
+		return true
+	})
+
+	if len(results) != 1 || results[0] != expect {
+		t.Fatal("not equal: ", results, expect)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	p, err := New(Config{
+		StartMatch: "total memory",
+		Rules: []rule.Config{
+			{Name: "total", Type: "datasize", To: "kb", Regex: `(\d+ \w) total memory`},
+		},
+		Fields:      map[string]interface{}{"source": "free", "version": 2},
+		LineField:   "lines",
+		OffsetField: "offset",
+		TimeField:   "parsed_at",
+	}, WithClock(func() time.Time { return time.Date(2018, 9, 19, 6, 46, 24, 0, time.UTC) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`{"total":197960064,"source":"free","version":2,"host":"db01","lines":[2,3],"offset":1,"parsed_at":"2018-09-19T06:46:24Z"}`,
+		`{"total":197960064,"source":"free","version":2,"host":"db01","lines":[4,6],"offset":` +
+			strconv.Itoa(bytes.LastIndex(memData, []byte("\t197960064"))) + `,"parsed_at":"2018-09-19T06:46:24Z"}`,
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(memData), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	}, Field{Name: "host", Value: "db01"})
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+
+	repeated := [][]Field{
+		{{Name: "total", Value: 1}},
+		{{Name: "source", Value: "call"}},
+		{{Name: "host", Value: "db01"}, {Name: "host", Value: "db02"}},
+	}
+
+	for _, fields := range repeated {
+		p.ParseWith(bytes.NewReader(memData), func(r Result) (ok bool) {
+			if r.Errors == nil {
+				t.Fatal("accepted repeated field name: ", fields)
+			}
+			return true
+		}, fields...)
+	}
+
+	_, err = New(Config{
+		StartMatch: "xxx",
+		Rules:      []rule.Config{{Name: "total", Type: "number"}},
+		Fields:     map[string]interface{}{"total": 1},
+	})
+	if err == nil {
+		t.Fatal("accepted repeated static field name")
+	}
+}
+
+func TestSticky(t *testing.T) {
+	p, err := New(Config{
+		StartMatch: "^Device",
+		Rules: []rule.Config{
+			{Name: "device", Type: "string", Regex: `^Device (\w+)`},
+			{Name: "util", Type: "int", Regex: `^Device \w+ (\d+)`},
+		},
+		Sticky: []rule.Config{
+			{Name: "host", Type: "string", Regex: `^host: (\w+)`},
+			{Name: "time", Type: "string", Regex: `^time: (\S+)`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("host: db01\ntime: 10:00\nDevice sda 10\nDevice sdb 20\ntime: 10:05\nDevice sda 30\n")
+	expect := []string{
+		`{"device":"sda","util":10,"host":"db01","time":"10:00"}`,
+		`{"device":"sdb","util":20,"host":"db01","time":"10:00"}`,
+		`{"device":"sda","util":30,"host":"db01","time":"10:05"}`,
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(data), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+}
+
+var traceData = []byte(`2018-09-19 06:46:24 ERROR request failed
+java.lang.IllegalStateException: connection closed
+	at com.example.Client.send(Client.java:42)
+	at com.example.Handler.handle(Handler.java:17)
+2018-09-19 06:46:25 INFO request ok
+2018-09-19 06:46:26 ERROR request failed
+java.lang.NullPointerException
+	at com.example.Handler.handle(Handler.java:21)
+	at com.example.Server.run(Server.java:7)
+	at java.lang.Thread.run(Thread.java:748)
+`)
+
+func TestMultiline(t *testing.T) {
+	p, err := New(Config{
+		StartMatch: `^\d{4}-\d{2}-\d{2}`,
+		Multiline:  &Multiline{Negate: true, MaxLines: 4},
+		Rules: []rule.Config{
+			{Name: "level", Type: "string", Regex: `^\S+ \S+ (\w+)`},
+			{Name: "exception", Type: "string", Regex: `(?m)^([\w.]+(?:Exception|Error))`},
+			{Name: "frame", Type: "string", Regex: `(?s)\tat ([^\n]+)$`},
+		},
+		LineField: "lines",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`{"level":"ERROR","exception":"java.lang.IllegalStateException","frame":"com.example.Handler.handle(Handler.java:17)","lines":[1,4]}`,
+		`{"level":"INFO","lines":[5,5]}`,
+		`{"level":"ERROR","exception":"java.lang.NullPointerException","frame":"com.example.Server.run(Server.java:7)","lines":[6,10]}`,
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(traceData), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+
+	if len(results[2].Errors) != 1 || results[2].Errors[0] != errMultilineTruncated {
+		t.Fatal("expected truncated record, got: ", results[2].Errors)
+	}
+
+	p, err = New(Config{
+		Multiline: &Multiline{Indent: true, Continue: `^Caused by`},
+		Rules:     []rule.Config{{Name: "causes", Type: "string", Regex: `(?s)(Caused by.*)`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results = nil
+	p.ParseWith(bytes.NewReader([]byte("Exception a\n\tat x\nCaused by: b\n\tat y\nException c\n")), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != 1 || string(results[0].Data) != `{"causes":"Caused by: b\n\tat y"}` {
+		t.Fatal("invalid results: ", results)
+	}
+
+	// blank lines inside a block are kept, trailing blank lines are not
+	p, err = New(Config{
+		Multiline: &Multiline{Indent: true},
+		Rules:     []rule.Config{{Name: "block", Type: "string", Regex: `(?s)^(.*)$`}},
+		LineField: "lines",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results = nil
+	p.ParseWith(bytes.NewReader([]byte("interface a\n mtu 1500\n\n description x\n\ninterface b\n\n")), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	expect = []string{
+		`{"block":"interface a\n mtu 1500\n\n description x","lines":[1,4]}`,
+		`{"block":"interface b","lines":[6,6]}`,
+	}
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	rules := []rule.Config{
+		{Name: "processor", Type: "int", Regex: `^processor\s*: (\d+)`},
+		{Name: "model", Type: "string", Regex: `^model name\s*: (.*)`},
+		{Name: "end", Type: "bool", Regex: `^end: (\w+)`},
+	}
+
+	blankData := []byte("processor : 0\nmodel name : xeon\n\nprocessor : 1\nmodel name : epyc\n\n\n")
+	spaceData := []byte("processor : 0\nmodel name : xeon\n  \r\nprocessor : 1\nmodel name : epyc\n\t\n")
+	endData := []byte("processor : 0\nmodel name : xeon\nend: true\nprocessor : 1\nmodel name : epyc\nend: true\n")
+
+	delimCases := []struct {
+		name   string
+		config Config
+		data   []byte
+		expect []string
+	}{
+		{"blank_line", Config{BlankLine: true, Rules: rules}, blankData,
+			[]string{`{"processor":0,"model":"xeon"}`, `{"processor":1,"model":"epyc"}`}},
+		{"blank_line_whitespace", Config{BlankLine: true, Rules: rules}, spaceData,
+			[]string{`{"processor":0,"model":"xeon"}`, `{"processor":1,"model":"epyc"}`}},
+		{"end_match", Config{EndMatch: `^end:`, Rules: rules}, endData,
+			[]string{`{"processor":0,"model":"xeon","end":true}`, `{"processor":1,"model":"epyc","end":true}`}},
+		{"end_match_exclusive", Config{EndMatch: `^end:`, EndExclusive: true, Rules: rules}, endData,
+			[]string{`{"processor":0,"model":"xeon"}`, `{"processor":1,"model":"epyc"}`}},
+		{"record_lines", Config{RecordLines: 2, Rules: rules}, blankData,
+			[]string{`{"processor":0,"model":"xeon"}`, `{"processor":1,"model":"epyc"}`}},
+	}
+
+	for _, testCase := range delimCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p, err := New(testCase.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var results []Result
+			p.ParseWith(bytes.NewReader(testCase.data), func(r Result) (ok bool) {
+				results = append(results, r)
+				return true
+			})
+
+			if len(results) != len(testCase.expect) {
+				t.Fatal("invalid number of results: ", len(results))
+			}
+
+			for i := range results {
+				if string(results[i].Data) != testCase.expect[i] {
+					t.Fatal("not equal: ", string(results[i].Data), testCase.expect[i])
+				}
+			}
+		})
+	}
+}
+
+var gateData = []byte(`a 0
+start
+a 1
+a 7 skip
+a 2
+a 8 skip
+a 3
+a 9 resume
+a 4
+a 10 resume
+a 5
+stop
+a 6
+`)
+
+func TestSkipResume(t *testing.T) {
+	gateCases := []struct {
+		name   string
+		config Config
+		expect []int
+	}{
+		{"none", Config{}, []int{0, 1, 7, 2, 8, 3, 9, 4, 10, 5, 6}},
+		{"start", Config{StartMatch: `^start`}, []int{1, 7, 2, 8, 3, 9, 4, 10, 5, 6}},
+		{"stop", Config{StopMatch: `^stop`}, []int{0, 1, 7, 2, 8, 3, 9, 4, 10, 5}},
+		{"start_stop", Config{StartMatch: `^start`, StopMatch: `^stop`}, []int{1, 7, 2, 8, 3, 9, 4, 10, 5}},
+		{"skip_resume", Config{SkipMatch: `skip$`, ResumeMatch: `resume$`}, []int{0, 1, 10, 5, 6}},
+		{"skip_exclusive", Config{SkipMatch: `skip$`, ResumeMatch: `resume$`, SkipExclusive: true}, []int{0, 1, 7, 10, 5, 6}},
+		{"resume_inclusive", Config{SkipMatch: `skip$`, ResumeMatch: `resume$`, ResumeInclusive: true}, []int{0, 1, 5, 6}},
+		{"skip_exclusive_resume_inclusive", Config{SkipMatch: `skip$`, ResumeMatch: `resume$`, SkipExclusive: true, ResumeInclusive: true}, []int{0, 1, 7, 5, 6}},
+		{"start_skip_resume", Config{StartMatch: `^start`, SkipMatch: `skip$`, ResumeMatch: `resume$`}, []int{1, 10, 5, 6}},
+		{"stop_skip_resume", Config{StopMatch: `^stop`, SkipMatch: `skip$`, ResumeMatch: `resume$`}, []int{0, 1, 10, 5}},
+		{"start_stop_skip_resume", Config{StartMatch: `^start`, StopMatch: `^stop`, SkipMatch: `skip$`, ResumeMatch: `resume$`}, []int{1, 10, 5}},
+		{"toggle", Config{SkipMatch: `skip$`, ResumeMatch: `skip$`}, []int{0, 1, 8, 3, 9, 4, 10, 5, 6}},
+	}
+
+	run := func(t *testing.T, config Config, expect []int) {
+		p, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []Result
+		p.ParseWith(bytes.NewReader(gateData), func(r Result) (ok bool) {
+			results = append(results, r)
+			return true
+		})
+
+		if len(results) != len(expect) {
+			t.Fatal("invalid number of results: ", len(results), len(expect))
+		}
+
+		for i := range results {
+			if e := `{"n":` + strconv.Itoa(expect[i]) + `}`; string(results[i].Data) != e {
+				t.Fatal("not equal: ", string(results[i].Data), e)
+			}
+		}
+	}
+
+	for _, testCase := range gateCases {
+		t.Run("line_"+testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.Regex = `^a (\d+)`
+			config.Rules = []rule.Config{{Name: "n", Type: "int"}}
+			run(t, config, testCase.expect)
+		})
+
+		// in record set mode the start match delimits records instead of gating them
+		if testCase.config.StartMatch != "" {
+			continue
+		}
+
+		t.Run("set_"+testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.StartMatch = `^a`
+			config.Rules = []rule.Config{{Name: "n", Type: "int", Regex: `^a (\d+)`}}
+			run(t, config, testCase.expect)
+		})
+	}
+}
+
+func TestSkipWithoutResume(t *testing.T) {
+	_, err := New(Config{
+		StartMatch: `^a`,
+		SkipMatch:  `skip$`,
+		Rules:      []rule.Config{{Name: "n", Type: "int", Regex: `^a (\d+)`}},
+	})
+
+	if err != errSkipResume {
+		t.Fatal("not equal: ", err, errSkipResume)
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	data := []byte("a 1\na 999999999999\na " + strings.Repeat("9", 10000) + "\na 3\n")
+
+	parse := func(t *testing.T, policy LongLines) (results []Result) {
+		p, err := New(Config{
+			Regex:        `(\d+)$`,
+			MaxLineBytes: 8,
+			LongLines:    policy,
+			Rules:        []rule.Config{{Name: "n", Type: "string"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.ParseWith(bytes.NewReader(data), func(r Result) (ok bool) {
+			results = append(results, r)
+			return true
+		})
+		return results
+	}
+
+	expect := func(t *testing.T, results []Result, values ...string) {
+		if len(results) != len(values) {
+			t.Fatal("invalid number of results: ", len(results), len(values))
+		}
+		for i := range values {
+			if e := `{"n":"` + values[i] + `"}`; string(results[i].Data) != e {
+				t.Fatal("not equal: ", string(results[i].Data), e)
+			}
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		results := parse(t, "")
+		if len(results) != 2 || results[1].Data != nil {
+			t.Fatal("invalid results: ", results)
+		}
+		expect(t, results[:1], "1")
+		if len(results[1].Errors) != 1 || results[1].Errors[0] != bufio.ErrTooLong {
+			t.Fatal("not equal: ", results[1].Errors, bufio.ErrTooLong)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		expect(t, parse(t, LongLinesTruncate), "1", "999999", "999999", "3")
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		results := parse(t, LongLinesSkip)
+		expect(t, results, "1", "3")
+		if len(results[1].Errors) != 2 || !errors.Is(results[1].Errors[0], errLongLine) {
+			t.Fatal("invalid errors: ", results[1].Errors)
+		}
+		if results[1].Errors[1].Error() != "line 3: "+errLongLine.Error() {
+			t.Fatal("not equal: ", results[1].Errors[1], "line 3")
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		results := parse(t, LongLinesSplit)
+		if len(results) != 1255 {
+			t.Fatal("invalid number of results: ", len(results))
+		}
+		expect(t, results[:5], "1", "999999", "999999", "999999", "99999999")
+		expect(t, results[1253:], "99", "3")
+
+		// fragments of a split line share its line number
+		p, err := New(Config{Regex: `(\d+)$`, MaxLineBytes: 8, LongLines: LongLinesSplit,
+			Rules: []rule.Config{{Name: "n", Type: "string"}}, LineField: "line"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lines []string
+		sum, _ := p.ParseWithContext(context.Background(), bytes.NewReader(data), func(r Result) (ok bool) {
+			lines = append(lines, string(r.Data[bytes.Index(r.Data, []byte(`"line"`)):]))
+			return true
+		})
+
+		if lines[1] != `"line":[2,2]}` || lines[1253] != `"line":[3,3]}` || lines[1254] != `"line":[4,4]}` {
+			t.Fatal("invalid line numbers: ", lines[1], lines[1253], lines[1254])
+		}
+
+		if sum.Lines != 4 {
+			t.Fatal("not equal: ", sum.Lines, 4)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := New(Config{Regex: `(\d+)`, LongLines: "wrap", Rules: []rule.Config{{Name: "n", Type: "string"}}}); err != errLongLinePolicy {
+			t.Fatal("not equal: ", err, errLongLinePolicy)
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	splitCases := []struct {
+		name   string
+		config Config
+		data   string
+		expect []string
+	}{
+		{"newline", Config{}, "A=1\r\nB=2\n", []string{"A", "B"}},
+		{"crlf", Config{Split: SplitCRLF}, "A=1\nx\r\nB=2\r\n", []string{"A", "B"}},
+		{"cr", Config{Split: SplitCR}, "A=1\rB=2\r", []string{"A", "B"}},
+		{"nul", Config{Split: SplitNUL}, "A=1\x00B=2", []string{"A", "B"}},
+		{"bytes", Config{Split: SplitBytes, Separator: "||"}, "A=1||B=2||", []string{"A", "B"}},
+		{"regex", Config{Split: SplitRegex, Separator: `;\s*`}, "A=1; B=2;C=3", []string{"A", "B", "C"}},
+		{"nul_long_skip", Config{Split: SplitNUL, MaxLineBytes: 8, LongLines: LongLinesSkip},
+			"A=1\x00B=" + strings.Repeat("2", 5000) + "\x00C=3", []string{"A", "C"}},
+		{"bytes_long_truncate", Config{Split: SplitBytes, Separator: "||", MaxLineBytes: 8, LongLines: LongLinesTruncate},
+			"A=1||B=" + strings.Repeat("2", 5000) + "|" + "||C=3", []string{"A", "B", "C"}},
+	}
+
+	for _, testCase := range splitCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.Regex = `(\w+)=(\S*)`
+			config.Rules = []rule.Config{{Name: "k", Type: "string"}, {Name: "v", Type: "string"}}
+
+			p, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var results []Result
+			p.ParseWith(strings.NewReader(testCase.data), func(r Result) (ok bool) {
+				results = append(results, r)
+				return true
+			})
+
+			if len(results) != len(testCase.expect) {
+				t.Fatal("invalid number of results: ", len(results))
+			}
+
+			for i := range results {
+				if !bytes.HasPrefix(results[i].Data, []byte(`{"k":"`+testCase.expect[i]+`"`)) {
+					t.Fatal("not equal: ", string(results[i].Data), testCase.expect[i])
+				}
+			}
+		})
+	}
+
+	invalidCases := []struct {
+		config Config
+		err    error
+	}{
+		{Config{Split: "tab"}, errSplit},
+		{Config{Split: SplitBytes}, errSeparator},
+		{Config{Split: SplitRegex, Separator: `x*`}, errSeparator},
+	}
+
+	for _, testCase := range invalidCases {
+		config := testCase.config
+		config.Regex = `(\w+)`
+		config.Rules = []rule.Config{{Name: "k", Type: "string"}}
+
+		if _, err := New(config); err != testCase.err {
+			t.Fatal("not equal: ", err, testCase.err)
+		}
+	}
+}
+
+func utf16Bytes(s string, bigEndian, bom bool) (b []byte) {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+	for _, u := range units {
+		if bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestEncoding(t *testing.T) {
+	encodingCases := []struct {
+		name     string
+		encoding Encoding
+		data     []byte
+		expect   string
+	}{
+		{"none_invalid", "", []byte("name=a\xffb\n"), "a�b"},
+		{"utf8_bom", EncodingUTF8, []byte("\xef\xbb\xbfname=Zoë €\n"), "Zoë €"},
+		{"utf16_bom_le", EncodingUTF16, utf16Bytes("name=Zoë 😀\r\n", false, true), "Zoë 😀"},
+		{"utf16_bom_be", EncodingUTF16, utf16Bytes("name=Zoë 😀\r\n", true, true), "Zoë 😀"},
+		{"utf16le", EncodingUTF16LE, utf16Bytes("name=Zoë 😀\n", false, false), "Zoë 😀"},
+		{"utf16be", "UTF-16BE", utf16Bytes("name=Zoë 😀\n", true, false), "Zoë 😀"},
+		{"utf16_unpaired", EncodingUTF16LE, []byte{'n', 0, '=', 0, 0x00, 0xd8, 'x', 0}, "�x"},
+		{"iso88591", EncodingISO88591, []byte("name=Zo\xeb\n"), "Zoë"},
+		{"iso88592", EncodingISO88592, []byte("name=\xa3\xf3d\xbc\n"), "Łódź"},
+		{"iso88595", EncodingISO88595, []byte("name=\xbf\xe0\xd8\xd2\xd5\xe2\n"), "Привет"},
+		{"iso88597", EncodingISO88597, []byte("name=\xc5\xeb\xeb\xdc\xe4\xe1\n"), "Ελλάδα"},
+		{"iso88598_undefined", EncodingISO88598, []byte("name=\xa1\xe0\n"), "�א"},
+		{"iso88599", "ISO-8859-9", []byte("name=\xddstanbul\n"), "İstanbul"},
+		{"iso885915", EncodingISO885915, []byte("name=\xa4 \xbd\n"), "€ œ"},
+		{"iso885916", EncodingISO885916, []byte("name=\xdear\xe3\n"), "Țară"},
+		{"windows1252", EncodingWindows1252, []byte("name=\x93hi\x94 \x80\n"), "“hi” €"},
+	}
+
+	for _, testCase := range encodingCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p, err := New(Config{
+				Encoding: testCase.encoding,
+				Regex:    `=(.*)`,
+				Rules:    []rule.Config{{Name: "name", Type: "string"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var results []Result
+			p.ParseWith(iotest.OneByteReader(bytes.NewReader(testCase.data)), func(r Result) (ok bool) {
+				results = append(results, r)
+				return true
+			})
+
+			if len(results) != 1 {
+				t.Fatal("invalid number of results: ", len(results))
+			}
+
+			if e := `{"name":"` + testCase.expect + `"}`; string(results[0].Data) != e {
+				t.Fatal("not equal: ", string(results[0].Data), e)
+			}
+		})
+	}
+
+	if _, err := New(Config{Encoding: "ebcdic", Regex: `(.*)`, Rules: []rule.Config{{Name: "n", Type: "string"}}}); err != errEncoding {
+		t.Fatal("not equal: ", err, errEncoding)
+	}
+}
+
+// bzip2 compressed "a 3\na 4\n"
+var bzip2Data = []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x42\xb8\x86\xe3\x00\x00\x03\x59\x00\x00\x10\x40\x00\x0c\x00\x20\x00\x20\x00\x30\xcd\x00\x92\x66\xa6\xc8\x89\xe2\xee\x48\xa7\x0a\x12\x08\x57\x10\xdc\x60")
+
+// xz compressed "a 5\na 6\n"
+var xzData = []byte("\xfd\x37\x7a\x58\x5a\x00\x00\x04\xe6\xd6\xb4\x46\x04\xc0\x0c\x08\x21\x01\x16\x00\x00\x00\x00\x00\x00\x00\x00\x00\xac\x77\xaa\xa4\x01\x00\x07\x61\x20\x35\x0a\x61\x20\x36\x0a\x00\x89\x13\xe7\x8d\x63\x63\xc5\x72\x00\x01\x28\x08\xb3\x93\x00\x73\x1f\xb6\xf3\x7d\x01\x00\x00\x00\x00\x04\x59\x5a")
+
+// zstd compressed "a 7\na 8\n"
+var zstdData = []byte("\x28\xb5\x2f\xfd\x04\x58\x41\x00\x00\x61\x20\x37\x0a\x61\x20\x38\x0a\x46\xc6\xd4\x3d")
+
+func TestDecompress(t *testing.T) {
+	// concatenated gzip members
+	var gzipData bytes.Buffer
+	for _, member := range []string{"a 1\n", "a 2\n"} {
+		w := gzip.NewWriter(&gzipData)
+		w.Write([]byte(member))
+		w.Close()
+	}
+
+	decompressCases := []struct {
+		name   string
+		data   []byte
+		expect []string
+		err    error
+	}{
+		{"plain", []byte("a 1\na 2\n"), []string{"1", "2"}, nil},
+		{"gzip", gzipData.Bytes(), []string{"1", "2"}, nil},
+		{"bzip2", bzip2Data, []string{"3", "4"}, nil},
+		{"xz", xzData, []string{"5", "6"}, nil},
+		{"zstd", zstdData, []string{"7", "8"}, nil},
+		{"xz_truncated", xzData[:8], nil, io.ErrUnexpectedEOF},
+		{"zstd_truncated", zstdData[:6], nil, io.ErrUnexpectedEOF},
+	}
+
+	p, err := New(Config{
+		Decompress: true,
+		Regex:      `^a (\d+)`,
+		Rules:      []rule.Config{{Name: "n", Type: "int"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range decompressCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var results []Result
+			p.ParseWith(bytes.NewReader(testCase.data), func(r Result) (ok bool) {
+				results = append(results, r)
+				return true
+			})
+
+			if testCase.err != nil {
+				if len(results) != 1 || len(results[0].Errors) != 1 || results[0].Errors[0] != testCase.err {
+					t.Fatal("not equal: ", results, testCase.err)
+				}
+				return
+			}
+
+			if len(results) != len(testCase.expect) {
+				t.Fatal("invalid number of results: ", len(results))
+			}
+
+			for i := range results {
+				if e := `{"n":` + testCase.expect[i] + `}`; string(results[i].Data) != e {
+					t.Fatal("not equal: ", string(results[i].Data), e)
+				}
+			}
+		})
+	}
+}
+
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	config := FollowConfig{
+		Path:       path,
+		Checkpoint: filepath.Join(dir, "app.checkpoint"),
+		Interval:   Duration(time.Nanosecond),
+		Poll:       Duration(10 * time.Millisecond),
+		FromStart:  true,
+	}
+
+	p, err := New(Config{
+		StartMatch: `^start`,
+		FlushIdle:  Duration(50 * time.Millisecond),
+		Rules:      []rule.Config{{Name: "n", Type: "int", Regex: `^a (\d+)`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(flag int, data string) {
+		file, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString(data)
+		file.Close()
+	}
+
+	follow := func() (f *Follower, results chan Result) {
+		if f, err = NewFollower(config); err != nil {
+			t.Fatal(err)
+		}
+
+		results = make(chan Result, 16)
+		go func() {
+			p.ParseWith(f, func(r Result) (ok bool) {
+				results <- r
+				return true
+			})
+			close(results)
+		}()
+		return f, results
+	}
+
+	expect := func(results chan Result, e string) {
+		select {
+		case r := <-results:
+			if string(r.Data) != e || r.Errors != nil {
+				t.Fatal("not equal: ", string(r.Data), r.Errors, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for: ", e)
+		}
+	}
+
+	write(os.O_TRUNC, "start\na 1\n")
+	f, results := follow()
+	expect(results, `{"n":1}`)
+
+	// growth
+	write(os.O_APPEND, "start\na 2\n")
+	expect(results, `{"n":2}`)
+
+	// rename rotation
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_TRUNC, "start\na 30\n")
+	expect(results, `{"n":30}`)
+
+	// truncation, the new content is shorter than the read offset
+	// so the truncation is seen whether it's polled before or after the write
+	if err = os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_APPEND, "start\na 4\n")
+	expect(results, `{"n":4}`)
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := <-results; ok {
+		t.Fatal("unexpected result after close: ", string(r.Data), r.Errors)
+	}
+
+	data, err := os.ReadFile(config.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := `{"path":"` + path + `","offset":10}`; string(data) != e {
+		t.Fatal("not equal: ", string(data), e)
+	}
+
+	// resume after the checkpoint
+	write(os.O_APPEND, "start\na 5\n")
+	f, results = follow()
+	expect(results, `{"n":5}`)
+	f.Close()
+}
+
+func TestStreaming(t *testing.T) {
+	rules := []rule.Config{{Name: "n", Type: "int", Regex: `^a (\d+)`}}
+
+	expect := func(results <-chan Result, e string) {
+		select {
+		case r := <-results:
+			if string(r.Data) != e {
+				t.Fatal("not equal: ", string(r.Data), e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for: ", e)
+		}
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		p, err := New(Config{StartMatch: `^start`, FlushIdle: Duration(50 * time.Millisecond), Rules: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, w := io.Pipe()
+		defer w.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		results := p.Parse(ctx, r)
+
+		w.Write([]byte("start\na 1\n"))
+		expect(results, `{"n":1}`)
+		w.Write([]byte("start\n"))
+		w.Write([]byte("a 2\n"))
+		expect(results, `{"n":2}`)
+
+		// the context ends parsing while the reader blocks
+		cancel()
+		select {
+		case _, ok := <-results:
+			if ok {
+				t.Fatal("unexpected result after cancel")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for cancel")
+		}
+	})
+
+	t.Run("idle_cancel", func(t *testing.T) {
+		p, err := New(Config{Regex: `^a (\d+)`, FlushIdle: Duration(10 * time.Second),
+			MaxLineBytes: 8, LongLines: LongLinesSkip, Rules: []rule.Config{{Name: "n", Type: "int"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// cancellation ends an idle wait, the feeder skips a long line after parsing ends
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &cancelReader{cancel: cancel, release: make(chan struct{}), read: make(chan struct{})}
+		start := time.Now()
+		sum, err := p.ParseWithContext(ctx, r, func(r Result) (ok bool) {
+			return true
+		})
+		close(r.release)
+
+		if err != context.Canceled {
+			t.Fatal("not equal: ", err, context.Canceled)
+		}
+
+		if time.Since(start) > 5*time.Second || sum.Lines != 1 {
+			t.Fatal("cancel not handled on idle wait: ", time.Since(start), sum)
+		}
+		<-r.read
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "vmstat.log")
+		if err := os.WriteFile(path, []byte("start\na 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := NewFollower(FollowConfig{Path: path, Poll: Duration(10 * time.Millisecond), FromStart: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		p, err := New(Config{StartMatch: `^start`, FlushBlocked: true, Rules: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results := p.Parse(ctx, f)
+		expect(results, `{"n":1}`)
+
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString("start\na 2\n")
+		file.Close()
+		expect(results, `{"n":2}`)
+	})
+}
+
+// cancelReader reads a line, then cancels and blocks until released
+// before reading a long line, closing read when read past it
+type cancelReader struct {
+	cancel  context.CancelFunc
+	release chan struct{}
+	read    chan struct{}
+	reads   int
+}
+
+func (c *cancelReader) Read(p []byte) (n int, err error) {
+	c.reads++
+	switch c.reads {
+	case 1:
+		return copy(p, "a 1\n"), nil
+	case 2:
+		c.cancel()
+		<-c.release
+		return copy(p, "a 0123456789\n"), nil
+	}
+	close(c.read)
+	return 0, io.EOF
+}
+
+// endlessReader reads the same line forever
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (n int, err error) {
+	for n+len("nomatch\n") <= len(p) {
+		n += copy(p[n:], "nomatch\n")
+	}
+	return n, nil
+}
+
+// closeRecorder records if the reader was closed
+type closeRecorder struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c closeRecorder) Close() (err error) {
+	close(c.closed)
+	return nil
+}
+
+func TestParseWithContext(t *testing.T) {
+	config := Config{Regex: `^a (\d+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}}
+	p, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.CloseOnCancel = true
+	closing, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, w := io.Pipe()
+	defer w.Close()
+	late, lw := io.Pipe()
+	abandoned, aw := io.Pipe()
+	defer aw.Close()
+	errRead := errors.New("read failure")
+
+	contextCases := []struct {
+		name    string
+		parser  *Parser
+		data    io.Reader
+		done    func() // called once the context is done
+		timeout time.Duration
+		err     error
+		results int
+	}{
+		{"eof", p, strings.NewReader("a 1\na 2\n"), nil, time.Minute, nil, 2},
+		{"read_error", p, io.MultiReader(strings.NewReader("a 1\n"), iotest.ErrReader(errRead)), nil, time.Minute, errRead, 2},
+		{"no_match", p, endlessReader{}, nil, 50 * time.Millisecond, context.DeadlineExceeded, 0},
+		{"blocked_abandoned", p, abandoned, nil, 50 * time.Millisecond, context.DeadlineExceeded, 0},
+		{"blocked_close_on_cancel", closing, blocked, nil, 50 * time.Millisecond, context.DeadlineExceeded, 0},
+		{"blocked_between_lines", p, late, func() {
+			// the line read after the cancellation is not delivered
+			lw.Write([]byte("a 1\n"))
+			lw.Close()
+		}, 50 * time.Millisecond, context.DeadlineExceeded, 0},
+	}
+
+	for _, testCase := range contextCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), testCase.timeout)
+			defer cancel()
+
+			if done := testCase.done; done != nil {
+				go func() {
+					<-ctx.Done()
+					done()
+				}()
+			}
+
+			var results int
+			_, err := testCase.parser.ParseWithContext(ctx, testCase.data, func(r Result) (ok bool) {
+				results++
+				return true
+			})
+
+			if err != testCase.err {
+				t.Fatal("not equal: ", err, testCase.err)
+			}
+
+			if results != testCase.results {
+				t.Fatal("invalid number of results: ", results)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	errRead := errors.New("read failure")
+
+	summaryCases := []struct {
+		name   string
+		config Config
+		data   io.Reader
+		abort  bool
+		sum    Summary
+		err    error
+	}{
+		{"eof", Config{}, strings.NewReader("a 1\na x\nb\n"), false, Summary{Lines: 3, Records: 2, Errors: 1}, nil},
+		{"stop_match", Config{StopMatch: `^stop`}, strings.NewReader("a 1\nstop\na 2\n"), false, Summary{Lines: 2, Records: 1}, ErrStopMatch},
+		{"aborted", Config{}, strings.NewReader("a 1\na 2\n"), true, Summary{Lines: 1, Records: 1}, ErrAborted},
+		{"filtered", Config{Filter: `n > 1`}, strings.NewReader("a 1\na 2\n"), false, Summary{Lines: 2, Records: 1, Filtered: 1}, nil},
+		{"read_error", Config{}, io.MultiReader(strings.NewReader("a 1\n"), iotest.ErrReader(errRead)), false, Summary{Lines: 1, Records: 1}, errRead},
+	}
+
+	for _, testCase := range summaryCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.Regex = `^a (\w+)`
+			config.Rules = []rule.Config{{Name: "n", Type: "int"}}
+
+			p, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sum, err := p.ParseWithContext(context.Background(), testCase.data, func(r Result) (ok bool) {
+				return !testCase.abort
+			})
+
+			if err != testCase.err {
+				t.Fatal("not equal: ", err, testCase.err)
+			}
+
+			if sum != testCase.sum {
+				t.Fatal("not equal: ", sum, testCase.sum)
+			}
+		})
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	p, err := New(Config{
+		Regex:     `^a (\d+)`,
+		StopMatch: `^stop`,
+		Rules:     []rule.Config{{Name: "n", Type: "int"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := p.ParseStream(context.Background(), strings.NewReader("a 1\na 2\nstop\na 3\n"))
+
+	var results int
+	for range st.Results() {
+		results++
+	}
+
+	if results != 2 {
+		t.Fatal("invalid number of results: ", results)
+	}
+
+	if st.Err() != ErrStopMatch {
+		t.Fatal("not equal: ", st.Err(), ErrStopMatch)
+	}
+
+	if sum := (Summary{Lines: 3, Records: 2}); st.Summary() != sum {
+		t.Fatal("not equal: ", st.Summary(), sum)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	p, err := New(Config{Regex: `^a (\d+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errRead := errors.New("read failure")
+	sources := func() (sources []Source) {
+		for i := 0; i < 20; i++ {
+			var data strings.Builder
+			for j := 0; j < 10; j++ {
+				data.WriteString("a " + strconv.Itoa(i*100+j) + "\n")
+			}
+
+			src := Source{Name: "host" + strconv.Itoa(i), Reader: strings.NewReader(data.String())}
+			if i == 7 {
+				src.Reader = io.MultiReader(src.Reader, iotest.ErrReader(errRead))
+			}
+			sources = append(sources, src)
+		}
+		return sources
+	}
+
+	value := func(r Result) (n int) {
+		n, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(string(r.Data), `{"n":`), `}`))
+		return n
+	}
+
+	checkErr := func(sums []Summary, err error) {
+		var failed SourceErrors
+		if !errors.As(err, &failed) || len(failed) != 1 || failed[0].Source != 7 || failed[0].Name != "host7" {
+			t.Fatal("invalid source errors: ", err)
+		}
+
+		if !errors.Is(err, errRead) {
+			t.Fatal("not equal: ", err, errRead)
+		}
+
+		for i := range sums {
+			if sums[i].Records != 10 {
+				t.Fatal("invalid number of records: ", i, sums[i].Records)
+			}
+		}
+	}
+
+	t.Run("unordered", func(t *testing.T) {
+		last := make([]int, 20)
+		var results int
+
+		sums, err := p.ParseAll(context.Background(), sources(), 4, func(source int, r Result) (ok bool) {
+			if r.Data == nil {
+				return true
+			}
+			n := value(r)
+			if n/100 != source || (last[source] != 0 && n != last[source]+1) {
+				t.Error("out of order: ", source, n)
+			}
+			last[source] = n
+			results++
+			return true
+		})
+
+		checkErr(sums, err)
+		if results != 200 {
+			t.Fatal("invalid number of results: ", results)
+		}
+	})
+
+	t.Run("ordered", func(t *testing.T) {
+		last := -1
+		var results int
+
+		sums, err := p.ParseAllOrdered(context.Background(), sources(), 4, func(source int, r Result) (ok bool) {
+			if r.Data == nil {
+				return true
+			}
+			if n := value(r); n <= last || n/100 != source {
+				t.Error("out of order: ", source, n, last)
+			} else {
+				last = n
+			}
+			results++
+			return true
+		})
+
+		checkErr(sums, err)
+		if results != 200 {
+			t.Fatal("invalid number of results: ", results)
+		}
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		var results int
+
+		_, err := p.ParseAll(context.Background(), sources(), 4, func(source int, r Result) (ok bool) {
+			results++
+			return results < 5
+		})
+
+		if err != ErrAborted {
+			t.Fatal("not equal: ", err, ErrAborted)
+		}
+
+		if results != 5 {
+			t.Fatal("invalid number of results: ", results)
+		}
+	})
+
+	t.Run("aborted_close_on_cancel", func(t *testing.T) {
+		closing, err := New(Config{Regex: `^a (\d+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}, CloseOnCancel: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// aborting stops the other sources without closing them
+		r, w := io.Pipe()
+		blocked := closeRecorder{Reader: r, closed: make(chan struct{})}
+		aborted := make(chan struct{})
+		go func() {
+			<-aborted
+			w.Write([]byte("a 2\n"))
+			w.Close()
+		}()
+
+		_, err = closing.ParseAll(ctx, []Source{{Reader: blocked}, {Reader: strings.NewReader("a 1\n")}}, 2,
+			func(source int, r Result) (ok bool) {
+				if source == 1 {
+					close(aborted)
+				}
+				return false
+			})
+
+		if err != ErrAborted {
+			t.Fatal("not equal: ", err, ErrAborted)
+		}
+
+		select {
+		case <-blocked.closed:
+			t.Fatal("source closed on abort")
+		default:
+		}
+	})
+}
+
+func TestParseAt(t *testing.T) {
+	defer func(size int64) { minChunkSize = size }(minChunkSize)
+	minChunkSize = 64
+
+	var lines, records, blank, end strings.Builder
+	for i := 0; i < 500; i++ {
+		n := strconv.Itoa(i)
+		lines.WriteString("a " + n + "\n")
+		records.WriteString("start\nn: " + n + "\nv: " + n + "\n")
+		blank.WriteString("n: " + n + "\nv: " + n + "\n" + [2]string{"\n", " \t\r\n"}[i%2])
+		end.WriteString("n: " + n + "\nv: " + n + "\nend\n")
+	}
+	lines.WriteString("stop\na 500\n")
+
+	lineRules := []rule.Config{{Name: "n", Type: "int"}}
+	setRules := []rule.Config{{Name: "n", Type: "int", Regex: `^n: (\d+)`}, {Name: "v", Type: "string", Regex: `^v: (\d+)`}}
+
+	atCases := []struct {
+		name   string
+		config Config
+		data   string
+	}{
+		{"line", Config{Regex: `^a (\d+)`, Rules: lineRules, OffsetField: "offset"}, lines.String()},
+		{"line_stop", Config{Regex: `^a (\d+)`, StopMatch: `^stop`, Rules: lineRules}, lines.String()},
+		{"line_not_records", Config{Regex: `^(a) (\d+)`, Rules: lineRules}, lines.String()},
+		{"start_match", Config{StartMatch: `^start`, Rules: setRules, OffsetField: "offset"}, records.String()},
+		{"blank_line", Config{BlankLine: true, Rules: setRules}, blank.String()},
+		{"end_match", Config{EndMatch: `^end`, Rules: setRules}, end.String()},
+		{"sequential", Config{Regex: `^a (\d+)`, StartMatch: `^a 10$`, Rules: lineRules, LineField: "line"}, lines.String()},
+	}
+
+	for _, testCase := range atCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p, err := New(testCase.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expect []Result
+			expectSum, expectErr := p.ParseWithContext(context.Background(), strings.NewReader(testCase.data), func(r Result) (ok bool) {
+				expect = append(expect, r)
+				return true
+			})
+
+			var results []Result
+			sum, err := p.ParseAt(context.Background(), strings.NewReader(testCase.data), int64(len(testCase.data)), 4, func(r Result) (ok bool) {
+				results = append(results, r)
+				return true
+			})
+
+			if err != expectErr {
+				t.Fatal("not equal: ", err, expectErr)
+			}
+
+			if sum != expectSum {
+				t.Fatal("not equal: ", sum, expectSum)
+			}
+
+			if len(results) != len(expect) {
+				t.Fatal("invalid number of results: ", len(results), len(expect))
+			}
+
+			for i := range results {
+				if !bytes.Equal(results[i].Data, expect[i].Data) {
+					t.Fatal("not equal: ", string(results[i].Data), string(expect[i].Data))
+				}
+			}
+		})
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	p, err := New(Config{Regex: `^a (\d+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data strings.Builder
+	for i := 0; i < 10; i++ {
+		data.WriteString("a " + strconv.Itoa(i) + "\n")
+	}
+
+	t.Run("buffered", func(t *testing.T) {
+		st := p.ParseBuffered(context.Background(), strings.NewReader(data.String()), 16)
+
+		var n int
+		for r := range st.Results() {
+			if e := `{"n":` + strconv.Itoa(n) + `}`; string(r.Data) != e {
+				t.Fatal("not equal: ", string(r.Data), e)
+			}
+			n++
+		}
+
+		if n != 10 || st.Err() != nil || st.Summary().Records != 10 {
+			t.Fatal("invalid stream: ", n, st.Err(), st.Summary())
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		st := p.ParseBatch(context.Background(), strings.NewReader(data.String()), BatchConfig{Size: 4})
+
+		var sizes []int
+		var n int
+		for batch := range st.Batches() {
+			sizes = append(sizes, len(batch))
+			for _, r := range batch {
+				if e := `{"n":` + strconv.Itoa(n) + `}`; string(r.Data) != e {
+					t.Fatal("not equal: ", string(r.Data), e)
+				}
+				n++
+			}
+		}
+
+		if len(sizes) != 3 || sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+			t.Fatal("invalid batches: ", sizes)
+		}
+
+		if st.Err() != nil || st.Summary().Records != 10 {
+			t.Fatal("invalid stream: ", st.Err(), st.Summary())
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		r, w := io.Pipe()
+		defer w.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		st := p.ParseBatch(ctx, r, BatchConfig{Size: 100, Latency: Duration(20 * time.Millisecond)})
+
+		w.Write([]byte("a 1\na 2\n"))
+		select {
+		case batch := <-st.Batches():
+			if len(batch) != 2 {
+				t.Fatal("invalid batch size: ", len(batch))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for batch")
+		}
+	})
+}
+
+func TestParseWithReuse(t *testing.T) {
+	reuseCases := []struct {
+		name   string
+		config Config
+		data   string
+		expect []string
+	}{
+		{"line", Config{Regex: `^a (\w+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}, LineField: "line"},
+			"a 1\na x\na 3\n",
+			[]string{`{"n":1,"line":[1,1]}`, `{"n":0,"line":[2,2]} [rule n, input: x, error: strconv.ParseInt: parsing "x": invalid syntax]`, `{"n":3,"line":[3,3]}`}},
+		{"set", Config{BlankLine: true, Rules: []rule.Config{
+			{Name: "n", Type: "int", Regex: `^a (\w+)`},
+			{Name: "s", Type: "string", Regex: `^b (\w+)`}}},
+			"a 1\na 2\nb x\n\nb y\n\na z\n",
+			[]string{`{"n":1,"s":"x"}`, `{"s":"y"}`, ` [rule n, input: z, error: strconv.ParseInt: parsing "z": invalid syntax]`}},
+		{"multiline", Config{StartMatch: `^\S`, Multiline: &Multiline{Indent: true}, Rules: []rule.Config{
+			{Name: "head", Type: "string", Regex: `^(\w+)`},
+			{Name: "tail", Type: "string", Regex: `(?s)\n\s+(\w+)$`}}},
+			"one\n two\nthree\n four\n",
+			[]string{`{"head":"one","tail":"two"}`, `{"head":"three","tail":"four"}`}},
+	}
+
+	for _, testCase := range reuseCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p, err := New(testCase.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			collect := func(results *[]string) Processor {
+				return func(r Result) (ok bool) {
+					s := string(r.Data)
+					if r.Errors != nil {
+						s += fmt.Sprint(" ", r.Errors)
+					}
+					*results = append(*results, s)
+					return true
+				}
+			}
+
+			var results, reused []string
+			p.ParseWith(strings.NewReader(testCase.data), collect(&results))
+			if _, err = p.ParseWithReuse(context.Background(), strings.NewReader(testCase.data), collect(&reused)); err != nil {
+				t.Fatal(err)
+			}
+
+			expect := strings.Join(testCase.expect, "\n")
+			if strings.Join(results, "\n") != expect {
+				t.Fatal("not equal: ", results, testCase.expect)
+			}
+
+			if strings.Join(reused, "\n") != expect {
+				t.Fatal("not equal: ", reused, testCase.expect)
+			}
+		})
+	}
+}
+
+// benchLines has a record per line so delivery dominates parsing
+var benchLines = func() (data []byte) {
+	for i := 0; i < 10000; i++ {
+		data = append(data, "a "+strconv.Itoa(i)+"\n"...)
+	}
+	return data
+}()
+
+func benchmarkParser(b *testing.B) (p *Parser) {
+	p, err := New(Config{Regex: `^a (\d+)`, Rules: []rule.Config{{Name: "n", Type: "int"}}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(benchLines)))
+	b.ReportAllocs()
+	return p
+}
+
+func BenchmarkParseUnbuffered(b *testing.B) {
+	p := benchmarkParser(b)
+	for n := 0; n < b.N; n++ {
+		for r := range p.Parse(context.Background(), bytes.NewReader(benchLines)) {
+			result = r
+		}
+	}
+}
+
+func BenchmarkParseBuffered(b *testing.B) {
+	p := benchmarkParser(b)
+	for n := 0; n < b.N; n++ {
+		for r := range p.ParseBuffered(context.Background(), bytes.NewReader(benchLines), 256).Results() {
+			result = r
+		}
+	}
+}
+
+func BenchmarkParseBatch(b *testing.B) {
+	p := benchmarkParser(b)
+	for n := 0; n < b.N; n++ {
+		for batch := range p.ParseBatch(context.Background(), bytes.NewReader(benchLines), BatchConfig{Size: 128}).Batches() {
+			for i := range batch {
+				result = batch[i]
+			}
+		}
+	}
+}
+
+// benchmarkSetParser returns a parser evaluating its rules on every line
+func benchmarkSetParser(b *testing.B) (p *Parser) {
+	p, err := New(Config{RecordLines: 1, Rules: []rule.Config{
+		{Name: "line", Type: "string"},
+		{Name: "n", Regex: `^a (\d+)`, Type: "int"},
+	}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(benchLines)))
+	b.ReportAllocs()
+	return p
+}
+
+func BenchmarkParseWithAlloc(b *testing.B) {
+	p := benchmarkSetParser(b)
+	for n := 0; n < b.N; n++ {
+		p.ParseWithContext(context.Background(), bytes.NewReader(benchLines), func(r Result) bool {
+			result = r
+			return true
+		})
+	}
+}
+
+func BenchmarkParseWithReuse(b *testing.B) {
+	p := benchmarkSetParser(b)
+	for n := 0; n < b.N; n++ {
+		p.ParseWithReuse(context.Background(), bytes.NewReader(benchLines), func(r Result) bool {
+			result = r
+			return true
+		})
+	}
+}
+
+func TestPrefilter(t *testing.T) {
+	var rules []*rule.Rule
+	for i, regex := range []string{`(he)`, `(she)`, `(his)`, `(hers)`, `(\d+)`} {
+		r, err := rule.New(rule.Config{Name: strconv.Itoa(i), Type: "string", Regex: regex})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+
+	f := newPrefilter(rules)
+	candidates := make([]uint64, 1)
+
+	matches := []struct {
+		line   string
+		expect uint64
+	}{
+		{"ushers", 1<<0 | 1<<1 | 1<<3 | 1<<4},
+		{"this", 1<<2 | 1<<4},
+		{"hhh", 1 << 4},
+		{"", 1 << 4},
+	}
+
+	for _, m := range matches {
+		f.match([]byte(m.line), candidates)
+		if candidates[0] != m.expect {
+			t.Fatalf("not equal: %s %b %b", m.line, candidates[0], m.expect)
+		}
+	}
+
+	if newPrefilter(rules[4:]) != nil {
+		t.Fatal("prefilter without literals")
+	}
+}
+
+// benchSystem has records of system reports where each line matches one of many rules
+var benchSystem = func() (data []byte) {
+	for i := 0; i < 1000; i++ {
+		data = append(data, "hostname node"+strconv.Itoa(i)+"\n"...)
+		data = append(data, "kernel version 5.15."+strconv.Itoa(i%100)+"\n"...)
+		data = append(data, "uptime 12 days, load average: 0.52\n"...)
+		data = append(data, "cpu model: Intel(R) Xeon(R) CPU E5-2680\n"...)
+		data = append(data, "cpu count: 32\n"...)
+		data = append(data, "total memory: 263921432 kB\n"...)
+		data = append(data, "free memory: 13349240 kB\n"...)
+		data = append(data, "swap total: 8388604 kB\n"...)
+		data = append(data, "disk /dev/sda1 used 42%\n"...)
+		data = append(data, "interface eth0 rx bytes 1283912 tx bytes 9123123\n"...)
+		data = append(data, "last login from 10.0.0."+strconv.Itoa(i%255)+"\n"...)
+		data = append(data, "\n"...)
+	}
+	return data
+}()
+
+var benchSystemConfig = Config{BlankLine: true, Rules: []rule.Config{
+	{Name: "hostname", Type: "string", Regex: `^hostname (\S+)`},
+	{Name: "kernel", Type: "string", Regex: `^kernel version (\S+)`},
+	{Name: "load", Type: "float", Regex: `load average: ([\d.]+)`},
+	{Name: "cpu_model", Type: "string", Regex: `^cpu model: (.+)$`},
+	{Name: "cpus", Type: "int", Regex: `^cpu count: (\d+)`},
+	{Name: "mem_total", Type: "int", Regex: `^total memory: (\d+) kB`},
+	{Name: "mem_free", Type: "int", Regex: `^free memory: (\d+) kB`},
+	{Name: "swap_total", Type: "int", Regex: `^swap total: (\d+) kB`},
+	{Name: "disk_used", Type: "int", Regex: `^disk \S+ used (\d+)%`},
+	{Name: "rx_bytes", Type: "int", Regex: `rx bytes (\d+)`},
+	{Name: "tx_bytes", Type: "int", Regex: `tx bytes (\d+)`},
+	{Name: "login", Type: "string", Regex: `last login from (\S+)`},
+}}
+
+func TestPrefilterResults(t *testing.T) {
+	p, err := New(benchSystemConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.prefilter == nil {
+		t.Fatal("prefilter not built")
+	}
+
+	var filtered, unfiltered []string
+	p.ParseWith(bytes.NewReader(benchSystem), func(r Result) (ok bool) {
+		filtered = append(filtered, string(r.Data))
+		return true
+	})
+
+	p.prefilter = nil
+	p.ParseWith(bytes.NewReader(benchSystem), func(r Result) (ok bool) {
+		unfiltered = append(unfiltered, string(r.Data))
+		return true
+	})
+
+	if len(filtered) != 1000 {
+		t.Fatal("invalid number of results: ", len(filtered))
+	}
+
+	if strings.Join(filtered, "\n") != strings.Join(unfiltered, "\n") {
+		t.Fatal("not equal: ", filtered[0], unfiltered[0])
+	}
+}
+
+// benchLogs has application log lines where rules extract rare events
+var benchLogs = func() (data []byte) {
+	for i := 0; i < 10000; i++ {
+		ts := "2020-01-02T15:04:" + strconv.Itoa(10+i%50) + "Z "
+		switch {
+		case i%100 == 0:
+			data = append(data, ts+"ERROR handler failed: java.io.IOException: connection reset by peer\n"...)
+		case i%50 == 0:
+			data = append(data, ts+"WARN slow query took "+strconv.Itoa(i)+"ms on table orders\n"...)
+		case i%20 == 0:
+			data = append(data, ts+"INFO user u"+strconv.Itoa(i)+" logged in from 10.1.2.3\n"...)
+		default:
+			data = append(data, ts+"INFO request handled method=GET path=/api/v1/items/"+strconv.Itoa(i)+" status=200 bytes=512\n"...)
+		}
+	}
+	return data
+}()
+
+var benchLogsConfig = Config{RecordLines: 1, Rules: []rule.Config{
+	{Name: "exception", Type: "string", Regex: `([\w.]+Exception): `},
+	{Name: "slow_query_ms", Type: "int", Regex: `slow query took (\d+)ms`},
+	{Name: "login", Type: "string", Regex: `user (\w+) logged in`},
+	{Name: "disk_full", Type: "string", Regex: `disk full on (\S+)`},
+	{Name: "oom", Type: "string", Regex: `out of memory: kill process (\d+)`},
+	{Name: "timeout", Type: "int", Regex: `upstream timed out after (\d+)s`},
+	{Name: "retry", Type: "int", Regex: `retrying in (\d+) seconds`},
+	{Name: "deprecated", Type: "string", Regex: `deprecated api (\S+) called`},
+}}
+
+func BenchmarkParseSet(b *testing.B) {
+	benchmarks := []struct {
+		name      string
+		config    Config
+		data      []byte
+		prefilter bool
+	}{
+		{"system/regex", benchSystemConfig, benchSystem, false},
+		{"system/prefilter", benchSystemConfig, benchSystem, true},
+		{"logs/regex", benchLogsConfig, benchLogs, false},
+		{"logs/prefilter", benchLogsConfig, benchLogs, true},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			p, err := New(bm.config)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !bm.prefilter {
+				p.prefilter = nil
+			}
+
+			b.SetBytes(int64(len(bm.data)))
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				p.ParseWithReuse(context.Background(), bytes.NewReader(bm.data), func(r Result) bool {
+					result = r
+					return true
+				})
+			}
+		})
+	}
+}
+
+var runningConfig = []byte(`hostname r1
+interface Gi0/1
+ description uplink
+ ip address 10.0.0.1 255.255.255.0
+ ipv6
+  address 2001::1/64
+ !
+!
+interface Gi0/2
+ description server
+!
+router ospf 1
+ network 10.0.0.0
+!
+`)
+
+func TestStates(t *testing.T) {
+	p, err := New(Config{
+		Rules:      []rule.Config{{Name: "hostname", Type: "string", Regex: `^hostname (\S+)`}},
+		StateField: "section",
+		States: []State{
+			{
+				Name:  "interface",
+				Enter: `^interface`,
+				Exit:  `^!$`,
+				Rules: []rule.Config{
+					{Name: "interface", Type: "string", Regex: `^interface (\S+)`},
+					{Name: "description", Type: "string", Regex: `^ description (.*)`},
+					{Name: "ip", Type: "string", Regex: `^ ip address (\S+)`},
+				},
+				States: []State{
+					{
+						Name:  "ipv6",
+						Enter: `^ ipv6$`,
+						Exit:  `^ !$`,
+						Rules: []rule.Config{{Name: "ipv6", Type: "string", Regex: `^  address (\S+)`}},
+					},
+				},
+			},
+			{
+				Name:  "router",
+				Enter: `^router`,
+				Exit:  `^!$`,
+				Rules: []rule.Config{
+					{Name: "ospf", Type: "int", Regex: `^router ospf (\d+)`},
+					{Name: "network", Type: "string", Regex: `^ network (\S+)`},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`{"hostname":"r1","interface":"Gi0/1","description":"uplink","ip":"10.0.0.1","ipv6":"2001::1/64","section":"interface.ipv6"}`,
+		`{"hostname":"r1","interface":"Gi0/1","description":"uplink","ip":"10.0.0.1","section":"interface"}`,
+		`{"hostname":"r1","interface":"Gi0/2","description":"server","section":"interface"}`,
+		`{"hostname":"r1","ospf":1,"network":"10.0.0.0","section":"router"}`,
+		`{"hostname":"r1","section":""}`,
+	}
+
+	var results []Result
+	p.ParseWith(bytes.NewReader(runningConfig), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != len(expect) {
+		t.Fatal("invalid number of results: ", len(results))
+	}
+
+	for i := range results {
+		if string(results[i].Data) != expect[i] {
+			t.Fatal("not equal: ", string(results[i].Data), expect[i])
+		}
+	}
+
+	// sections without exit are left when a sibling is entered
+	p, err = New(Config{
+		States: []State{{
+			Name:  "section",
+			Enter: `^\[`,
+			Rules: []rule.Config{
+				{Name: "section", Type: "string", Regex: `^\[(\w+)\]`},
+				{Name: "port", Type: "int", Regex: `^port = (\d+)`},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results = nil
+	p.ParseWith(bytes.NewReader([]byte("[http]\nport = 80\n[https]\nport = 443\n")), func(r Result) (ok bool) {
+		results = append(results, r)
+		return true
+	})
+
+	if len(results) != 2 || string(results[1].Data) != `{"section":"https","port":443}` {
+		t.Fatal("invalid results: ", results)
+	}
+}
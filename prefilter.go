@@ -0,0 +1,130 @@
+package rxde
+
+import (
+	"github.com/brunotm/rxde/rule"
+)
+
+// prefilter selects the rules that may match a line by searching the literals
+// required by their regexes with an Aho-Corasick automaton in a single pass
+type prefilter struct {
+	classes [256]int32 // byte class by byte, 0 for bytes not in any literal
+	width   int        // number of byte classes
+	delta   []int32    // next state by state and byte class
+	out     [][]int    // rule indexes with literals ending at each state
+	always  []uint64   // bitset of rules without literals
+}
+
+// newPrefilter builds the prefilter for the rules, nil if no rule has a literal
+func newPrefilter(rules []*rule.Rule) (f *prefilter) {
+	f = &prefilter{always: make([]uint64, (len(rules)+63)/64)}
+
+	var literals int
+	for r := range rules {
+		lit := rules[r].Literal()
+		if lit == "" {
+			setBit(f.always, r)
+			continue
+		}
+		literals++
+
+		for i := 0; i < len(lit); i++ {
+			if f.classes[lit[i]] == 0 {
+				f.width++
+				f.classes[lit[i]] = int32(f.width)
+			}
+		}
+	}
+
+	if literals == 0 {
+		return nil
+	}
+	f.width++
+
+	// build the trie of literals, -1 marks missing transitions
+	f.state()
+	for r := range rules {
+		lit := rules[r].Literal()
+		if lit == "" {
+			continue
+		}
+
+		var s int32
+		for i := 0; i < len(lit); i++ {
+			t := int(s)*f.width + int(f.classes[lit[i]])
+			if f.delta[t] < 0 {
+				// adding a state grows delta
+				next := f.state()
+				f.delta[t] = next
+			}
+			s = f.delta[t]
+		}
+		f.out[s] = append(f.out[s], r)
+	}
+
+	// complete the transitions following failure links in breadth first order
+	fail := make([]int32, len(f.out))
+	queue := make([]int32, 0, len(f.out))
+
+	for c := 0; c < f.width; c++ {
+		if next := f.delta[c]; next < 0 {
+			f.delta[c] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		if out := f.out[fail[s]]; len(out) > 0 {
+			f.out[s] = append(f.out[s][:len(f.out[s]):len(f.out[s])], out...)
+		}
+
+		for c := 0; c < f.width; c++ {
+			i := int(s)*f.width + c
+			failNext := f.delta[int(fail[s])*f.width+c]
+			if f.delta[i] < 0 {
+				f.delta[i] = failNext
+				continue
+			}
+			fail[f.delta[i]] = failNext
+			queue = append(queue, f.delta[i])
+		}
+	}
+
+	return f
+}
+
+// state adds a state with no transitions
+func (f *prefilter) state() (s int32) {
+	s = int32(len(f.out))
+	f.out = append(f.out, nil)
+	for c := 0; c < f.width; c++ {
+		f.delta = append(f.delta, -1)
+	}
+	return s
+}
+
+// match sets the rules that may match the line in the candidates bitset
+func (f *prefilter) match(line []byte, candidates []uint64) {
+	copy(candidates, f.always)
+
+	var s int32
+	for _, b := range line {
+		s = f.delta[int(s)*f.width+int(f.classes[b])]
+		for _, r := range f.out[s] {
+			setBit(candidates, r)
+		}
+	}
+}
+
+// hasBit returns true if the bit at index is set
+func hasBit(set []uint64, index int) bool {
+	return set[index>>6]&(1<<uint(index&63)) != 0
+}
+
+// setBit sets the bit at index
+func setBit(set []uint64, index int) {
+	set[index>>6] |= 1 << uint(index&63)
+}
@@ -0,0 +1,99 @@
+package rule
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	errTypeRegistered = errors.New("type already registered")
+	errNilConverter   = errors.New("nil converter")
+
+	convertersMtx sync.RWMutex
+	converters    = map[Type]Converter{}
+)
+
+// Converter implements a custom rule type
+type Converter interface {
+	// Kind returns the kind of the JSON values produced for the given config
+	Kind(config Config) (k Kind)
+	// Validate checks the rule config when creating a rule of this type
+	Validate(config Config) (err error)
+	// Convert the extracted data into its JSON serialization. s aliases the input
+	// buffer and is only valid during the call, it must be copied to be retained.
+	Convert(config Config, s string) (value []byte, err error)
+}
+
+// AppendConverter is optionally implemented by a Converter to append
+// the JSON serialization to dst instead of returning a new buffer
+type AppendConverter interface {
+	Converter
+	// AppendConvert is like Convert but appends the value to dst and returns the extended buffer
+	AppendConvert(dst []byte, config Config, s string) (value []byte, err error)
+}
+
+// ConvertFunc adapts a function into a Converter that accepts any config
+// and produces values of any kind. As in Converter.Convert, s is only valid during the call.
+type ConvertFunc func(config Config, s string) (value []byte, err error)
+
+// Kind returns KindAny
+func (f ConvertFunc) Kind(config Config) (k Kind) {
+	return KindAny
+}
+
+// Validate accepts any config
+func (f ConvertFunc) Validate(config Config) (err error) {
+	return nil
+}
+
+// Convert calls f(config, s)
+func (f ConvertFunc) Convert(config Config, s string) (value []byte, err error) {
+	return f(config, s)
+}
+
+// RegisterType registers a converter for a custom rule type.
+// Builtin and already registered types cannot be replaced.
+func RegisterType(t Type, c Converter) (err error) {
+	if t == "" {
+		return errInvalidType
+	}
+
+	if c == nil {
+		return errNilConverter
+	}
+
+	if builtinType(t) {
+		return errTypeRegistered
+	}
+
+	convertersMtx.Lock()
+	defer convertersMtx.Unlock()
+
+	if _, ok := converters[t]; ok {
+		return errTypeRegistered
+	}
+	converters[t] = c
+
+	return nil
+}
+
+// converter returns the registered converter for the given type
+func converter(t Type) (c Converter, ok bool) {
+	convertersMtx.RLock()
+	c, ok = converters[t]
+	convertersMtx.RUnlock()
+	return c, ok
+}
+
+func builtinType(t Type) bool {
+	switch t {
+	case Int, Uint, Float, Number, String, Bool, Time, RelTime, Duration, DataSize:
+		return true
+	}
+	return false
+}
+
+// JSONString returns s as a quoted and escaped JSON string, for use in converters
+func JSONString(s string) (value []byte) {
+	return AppendJSONString(nil, s)
+}
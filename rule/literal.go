@@ -0,0 +1,88 @@
+package rule
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// Literal returns the longest substring that must appear in the input for the rule
+// regex to match, or an empty string if the rule has no regex or no such literal.
+// Inputs not containing the literal can skip the rule evaluation.
+func (r *Rule) Literal() (s string) {
+	return r.literal
+}
+
+// requiredLiteral extracts the longest case sensitive literal required by any match of expr
+func requiredLiteral(expr string) (s string) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+
+	s, _ = literal(re.Simplify())
+
+	// invalid utf-8 input matches U+FFFD in the regex but not in the literal
+	if strings.ContainsRune(s, utf8.RuneError) {
+		return ""
+	}
+	return s
+}
+
+// literal returns the longest literal required by any match of re,
+// and whether re matches exactly that literal and nothing else
+func literal(re *syntax.Regexp) (s string, exact bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return "", false
+		}
+		return string(re.Rune), true
+
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		// zero width assertions don't break a literal run
+		return "", true
+
+	case syntax.OpCapture:
+		return literal(re.Sub[0])
+
+	case syntax.OpPlus:
+		s, _ = literal(re.Sub[0])
+		return s, false
+
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			s, _ = literal(re.Sub[0])
+		}
+		return s, false
+
+	case syntax.OpConcat:
+		var run strings.Builder
+		exact = true
+
+		for _, sub := range re.Sub {
+			l, e := literal(sub)
+			if e {
+				run.WriteString(l)
+				continue
+			}
+
+			exact = false
+			s = longest(s, run.String())
+			s = longest(s, l)
+			run.Reset()
+		}
+
+		return longest(s, run.String()), exact
+	}
+
+	return "", false
+}
+
+func longest(a, b string) string {
+	if len(b) > len(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,229 @@
+package rule
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errRelRange = errors.New("relative time out of range")
+
+	// layouts for the time of day in relative times
+	clockLayouts = []string{"15:04", "15:04:05", "3pm", "3:04pm", "3:04:05pm"}
+
+	// words ignored in relative times
+	relFillers = map[string]struct{}{
+		"about":  {},
+		"almost": {},
+		"around": {},
+		"nearly": {},
+		"over":   {},
+		"less":   {},
+		"than":   {},
+		"and":    {},
+		"at":     {},
+	}
+
+	// units of relative times by name
+	relUnits = map[string]relUnit{
+		"ms": relMillisecond, "msec": relMillisecond, "msecs": relMillisecond,
+		"millisecond": relMillisecond, "milliseconds": relMillisecond,
+		"s": relSecond, "sec": relSecond, "secs": relSecond, "second": relSecond, "seconds": relSecond,
+		"m": relMinute, "min": relMinute, "mins": relMinute, "minute": relMinute, "minutes": relMinute,
+		"h": relHour, "hr": relHour, "hrs": relHour, "hour": relHour, "hours": relHour,
+		"d": relDay, "day": relDay, "days": relDay,
+		"w": relWeek, "wk": relWeek, "wks": relWeek, "week": relWeek, "weeks": relWeek,
+		"mo": relMonth, "mos": relMonth, "month": relMonth, "months": relMonth,
+		"y": relYear, "yr": relYear, "yrs": relYear, "year": relYear, "years": relYear,
+	}
+
+	// longest span of each relative time unit, bounding relative times to the range of time.Duration
+	relSpans = [...]time.Duration{
+		relMillisecond: time.Millisecond,
+		relSecond:      time.Second,
+		relMinute:      time.Minute,
+		relHour:        time.Hour,
+		relDay:         24 * time.Hour,
+		relWeek:        7 * 24 * time.Hour,
+		relMonth:       31 * 24 * time.Hour,
+		relYear:        366 * 24 * time.Hour,
+	}
+)
+
+// relUnit of a relative time
+type relUnit uint8
+
+// Relative time units
+const (
+	relMillisecond relUnit = iota
+	relSecond
+	relMinute
+	relHour
+	relDay
+	relWeek
+	relMonth
+	relYear
+)
+
+// now returns the current time from the reference clock
+func (r *Rule) now() (t time.Time) {
+	if r.clock != nil {
+		return r.clock()
+	}
+	return time.Now()
+}
+
+// appendRelTime parses a relative time like "3 hours ago", "About a minute ago",
+// "in 2 days" or "yesterday 14:00" into the specified time format and appends it to dst
+func (r *Rule) appendRelTime(dst []byte, s string) (value []byte, err error) {
+	t, err := relTime(r.now(), s)
+	if err != nil {
+		return dst, err
+	}
+	return r.appendFormatTime(dst, t)
+}
+
+// relTime parses the relative time s using now as reference
+func relTime(now time.Time, s string) (t time.Time, err error) {
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return c == ' ' || c == '\t' || c == ','
+	})
+
+	// drop fillers and join split am/pm suffixes to the previous word
+	w := words[:0]
+	for i := range words {
+		if _, ok := relFillers[words[i]]; ok {
+			continue
+		}
+		if (words[i] == "am" || words[i] == "pm") && len(w) > 0 {
+			w[len(w)-1] += words[i]
+			continue
+		}
+		w = append(w, words[i])
+	}
+	words = w
+
+	if len(words) == 0 {
+		return t, errInvalidSrcFormat
+	}
+
+	t = now
+	switch words[0] {
+	case "now", "just", "right":
+		return now, nil
+	case "today":
+		return relClock(now, words[1:])
+	case "yesterday":
+		return relClock(now.AddDate(0, 0, -1), words[1:])
+	case "tomorrow":
+		return relClock(now.AddDate(0, 0, 1), words[1:])
+	}
+
+	sign := 0
+	switch {
+	case words[0] == "in":
+		sign = 1
+		words = words[1:]
+	case words[len(words)-1] == "ago":
+		sign = -1
+		words = words[:len(words)-1]
+	case len(words) > 2 && words[len(words)-2] == "from" && words[len(words)-1] == "now":
+		sign = 1
+		words = words[:len(words)-2]
+	default:
+		return t, errInvalidSrcFormat
+	}
+
+	if len(words) == 0 {
+		return t, errInvalidSrcFormat
+	}
+
+	for len(words) > 0 {
+		var n int
+		var unit string
+
+		switch words[0] {
+		case "a", "an", "one":
+			n = 1
+		default:
+			// number and unit may be written together, like 5m
+			d := 0
+			for d < len(words[0]) && words[0][d] >= '0' && words[0][d] <= '9' {
+				d++
+			}
+			if d == 0 {
+				return t, errInvalidSrcFormat
+			}
+			if n, err = strconv.Atoi(words[0][:d]); err != nil {
+				return t, err
+			}
+			unit = words[0][d:]
+		}
+
+		words = words[1:]
+		if unit == "" {
+			if len(words) == 0 {
+				return t, errInvalidSrcFormat
+			}
+			unit = words[0]
+			words = words[1:]
+		}
+
+		u, ok := relUnits[unit]
+		if !ok {
+			return t, errInvalidSrcFormat
+		}
+
+		if int64(n) > math.MaxInt64/int64(relSpans[u]) {
+			return t, errRelRange
+		}
+
+		n = n * sign
+		switch u {
+		case relMillisecond:
+			t = t.Add(time.Duration(n) * time.Millisecond)
+		case relSecond:
+			t = t.Add(time.Duration(n) * time.Second)
+		case relMinute:
+			t = t.Add(time.Duration(n) * time.Minute)
+		case relHour:
+			t = t.Add(time.Duration(n) * time.Hour)
+		case relDay:
+			t = t.AddDate(0, 0, n)
+		case relWeek:
+			t = t.AddDate(0, 0, n*7)
+		case relMonth:
+			t = t.AddDate(0, n, 0)
+		case relYear:
+			t = t.AddDate(n, 0, 0)
+		}
+	}
+
+	return t, nil
+}
+
+// relClock sets the time of day in words on the given day,
+// returning the start of the day if no time is specified
+func relClock(day time.Time, words []string) (t time.Time, err error) {
+	y, m, d := day.Date()
+
+	if len(words) == 0 {
+		return time.Date(y, m, d, 0, 0, 0, 0, day.Location()), nil
+	}
+
+	if len(words) > 1 {
+		return t, errInvalidSrcFormat
+	}
+
+	for i := range clockLayouts {
+		if t, err = time.Parse(clockLayouts[i], words[0]); err == nil {
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, day.Location()), nil
+		}
+	}
+
+	return t, errInvalidSrcFormat
+}
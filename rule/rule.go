@@ -11,12 +11,24 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
 type (
 	// Type to parse to
 	Type string
+
+	// Kind of the JSON values produced by a rule
+	Kind uint8
+)
+
+// Value kinds
+const (
+	KindAny Kind = iota
+	KindNumber
+	KindString
+	KindBool
 )
 
 const (
@@ -27,6 +39,7 @@ const (
 	String   Type = "string"
 	Bool     Type = "bool"
 	Time     Type = "time"
+	RelTime  Type = "reltime"
 	Duration Type = "duration"
 	DataSize Type = "datasize"
 	// DataRate Type = "datarate"
@@ -113,11 +126,26 @@ var (
 
 // Config rule
 type Config struct {
-	Name  string `json:"name"`  // Rule name
-	Type  Type   `json:"type"`  // Type to parse to
-	From  string `json:"from"`  // Optional format or unit to parse from
-	To    string `json:"to"`    // Optional format or unit to parse to
-	Regex string `json:"regex"` // Optional regexp used to extract data
+	Name    string   `json:"name"`    // Rule name
+	Type    Type     `json:"type"`    // Type to parse to
+	From    string   `json:"from"`    // Optional format or unit to parse from
+	To      string   `json:"to"`      // Optional format or unit to parse to
+	Regex   string   `json:"regex"`   // Optional regexp used to extract data
+	Layouts []string `json:"layouts"` // Optional time layouts tried in order after From
+
+	// Optional string transformations applied in order before parsing
+	Transforms []Transform `json:"transforms"`
+}
+
+// Option for creating a rule
+type Option func(r *Rule)
+
+// WithClock sets the reference clock for relative times and
+// timestamps without a year, defaults to time.Now
+func WithClock(clock func() time.Time) Option {
+	return func(r *Rule) {
+		r.clock = clock
+	}
 }
 
 // Rule to parse the given []byte string into the specified JSON serialization for Type.
@@ -125,13 +153,22 @@ type Config struct {
 // Units, origin and destination formats can be specified using the From/To parameters.
 // A rule has no state and is safe  for concurrent use.
 type Rule struct {
-	regex  *regexp.Regexp
-	config Config
+	regex      *regexp.Regexp
+	converter  Converter // converter for custom types
+	transforms []transform
+	layouts    []string // go time layouts to parse from
+	toLayout   string   // go time layout to format to
+	literal    string   // substring required by the regex
+	clock      func() time.Time
+	config     Config
 }
 
-// New creates a new rule with the given config
-func New(config Config) (rule *Rule, err error) {
+// New creates a new rule with the given config and options
+func New(config Config, opts ...Option) (rule *Rule, err error) {
 	rule = &Rule{}
+	for _, opt := range opts {
+		opt(rule)
+	}
 	if config.Regex != "" {
 		if rule.regex, err = regexp.Compile(config.Regex); err != nil {
 			return rule, err
@@ -140,6 +177,7 @@ func New(config Config) (rule *Rule, err error) {
 		if rule.regex.NumSubexp() != 1 {
 			return nil, errInvalidMatchNum
 		}
+		rule.literal = requiredLiteral(config.Regex)
 	}
 
 	if config.Name == "" {
@@ -150,6 +188,34 @@ func New(config Config) (rule *Rule, err error) {
 		return nil, errInvalidType
 	}
 
+	if !builtinType(config.Type) {
+		c, ok := converter(config.Type)
+		if !ok {
+			return nil, errInvalidType
+		}
+
+		if err = c.Validate(config); err != nil {
+			return nil, err
+		}
+		rule.converter = c
+	}
+
+	if rule.transforms, err = newTransforms(config.Transforms); err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case Time:
+		if rule.layouts, rule.toLayout, err = timeLayouts(config); err != nil {
+			return nil, err
+		}
+
+	case RelTime:
+		if rule.toLayout, err = timeLayout(config.To); err != nil {
+			return nil, err
+		}
+	}
+
 	rule.config = config
 	return rule, err
 }
@@ -159,6 +225,39 @@ func (r *Rule) Config() (c Config) {
 	return r.config
 }
 
+// Kind returns the kind of the JSON values produced by this rule
+func (r *Rule) Kind() (k Kind) {
+	switch r.config.Type {
+	case Int, Uint, Float, Number, DataSize:
+		return KindNumber
+
+	case String:
+		return KindString
+
+	case Bool:
+		return KindBool
+
+	case Duration:
+		if r.config.To == "string" {
+			return KindString
+		}
+		return KindNumber
+
+	case Time, RelTime:
+		switch r.config.To {
+		case "unix", "unix_milli", "unix_nano":
+			return KindNumber
+		}
+		return KindString
+	}
+
+	if r.converter != nil {
+		return r.converter.Kind(r.config)
+	}
+
+	return KindAny
+}
+
 // MarshalJSON creates a json config from this rule
 func (r *Rule) MarshalJSON() (data []byte, err error) {
 	return json.Marshal(&r.config)
@@ -178,34 +277,59 @@ func (r *Rule) UnmarshalJSON(data []byte) (err error) {
 
 	r.config = config
 	r.regex = rr.regex
+	r.converter = rr.converter
+	r.transforms = rr.transforms
+	r.layouts = rr.layouts
+	r.toLayout = rr.toLayout
+	r.literal = rr.literal
 
 	return nil
 }
 
 // Parse and transform the given data into the specified JSON serialization for Type.
 func (r *Rule) Parse(b []byte) (value []byte, matched bool, err error) {
+	value, matched, err = r.AppendParse(nil, b)
+	if len(value) == 0 {
+		value = nil
+	}
+	return value, matched, err
+}
+
+// AppendParse is like Parse but appends the JSON serialization to dst and returns the extended buffer.
+// Nothing is appended when the rule matches an empty value.
+func (r *Rule) AppendParse(dst, b []byte) (value []byte, matched bool, err error) {
 
 	// As we wont mutate the input avoid unnecessary allocations
 	s := bytesToString(b)
 
 	// Extract data with the provided regex if defined
 	if r.regex != nil {
-		match := r.regex.FindStringSubmatch(s)
+		match := r.regex.FindStringSubmatchIndex(s)
 		if match == nil {
-			return nil, false, nil
+			return dst, false, nil
 		}
 
-		s = match[1]
+		if match[2] < 0 {
+			s = ""
+		} else {
+			s = s[match[2]:match[3]]
+		}
+	}
+
+	for i := range r.transforms {
+		s = r.transforms[i].apply(s)
 	}
 
 	if len(s) == 0 {
-		return nil, true, nil
+		return dst, true, nil
 	}
 
+	value = dst
+
 	switch r.config.Type {
 
 	case String:
-		value = jsonString(s)
+		value = AppendJSONString(value, s)
 
 	case Int:
 		var i int64
@@ -228,16 +352,19 @@ func (r *Rule) Parse(b []byte) (value []byte, matched bool, err error) {
 		value = strconv.AppendBool(value, bl)
 
 	case Time:
-		value, err = r.parseTime(s)
+		value, err = r.appendTime(value, s)
+
+	case RelTime:
+		value, err = r.appendRelTime(value, s)
 
 	case Duration:
-		value, err = r.parseDuration(s)
+		value, err = r.appendDuration(value, s)
 
 	case DataSize:
-		value, err = r.parseDataSize(s)
+		value, err = r.appendDataSize(value, s)
 
 	default:
-		err = errInvalidType
+		value, err = r.appendConvert(value, s)
 	}
 
 	if err != nil {
@@ -247,8 +374,23 @@ func (r *Rule) Parse(b []byte) (value []byte, matched bool, err error) {
 	return value, true, err
 }
 
-// parseDuration parses a string representation of duration into a specified time unit or in a time.Duration
-func (r *Rule) parseDuration(s string) (value []byte, err error) {
+// appendConvert appends the value of a custom type from its converter
+func (r *Rule) appendConvert(dst []byte, s string) (value []byte, err error) {
+	switch c := r.converter.(type) {
+	case nil:
+		return dst, errInvalidType
+
+	case AppendConverter:
+		return c.AppendConvert(dst, r.config, s)
+	}
+
+	v, err := r.converter.Convert(r.config, s)
+	return append(dst, v...), err
+}
+
+// appendDuration parses a string representation of duration into a specified time unit or in a time.Duration
+// and appends it to dst
+func (r *Rule) appendDuration(dst []byte, s string) (value []byte, err error) {
 
 	s = strings.ToLower(s)
 
@@ -263,9 +405,10 @@ func (r *Rule) parseDuration(s string) (value []byte, err error) {
 
 	d, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, err
+		return dst, err
 	}
 
+	value = dst
 	switch r.config.To {
 
 	case "nanoseconds", "nanosecond", "nano", "ns":
@@ -284,20 +427,20 @@ func (r *Rule) parseDuration(s string) (value []byte, err error) {
 		value = strconv.AppendFloat(value, d.Hours(), 'f', -1, 64)
 
 	case "string":
-		value = make([]byte, 0, 32)
 		value = append(value, '"')
 		value = append(value, d.String()...)
 		value = append(value, '"')
 
 	default:
-		err = errInvalidDstFormat
+		value, err = dst, errInvalidDstFormat
 	}
 
 	return value, err
 }
 
-// parseTime parses a string representation of time from the specified format into a specified format or in a time.Time
-func (r *Rule) parseTime(s string) (value []byte, err error) {
+// appendTime parses a string representation of time from the specified format into a specified format or in a time.Time
+// and appends it to dst
+func (r *Rule) appendTime(dst []byte, s string) (value []byte, err error) {
 
 	var t time.Time
 
@@ -306,49 +449,44 @@ func (r *Rule) parseTime(s string) (value []byte, err error) {
 	case "unix":
 		i, err := strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return dst, err
 		}
 		t = time.Unix(i, 0)
 
 	case "unix_nano":
 		i, err := strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return dst, err
 		}
 		t = time.Unix(0, i)
 
 	case "unix_milli":
 		i, err := strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return dst, err
 		}
 		t = time.Unix(0, i*1000000)
 
-	case "rfc3339":
-		t, err = time.Parse(time.RFC3339, s)
-		if err != nil {
-			return nil, err
-		}
-
-	case "rfc3339nano":
-		t, err = time.Parse(time.RFC3339Nano, s)
-		if err != nil {
-			return nil, err
-		}
-
-	case "iso8601":
-		t, err = time.Parse(iso8601, s)
+	case "auto":
+		t, err = r.parseTimeAuto(s)
 		if err != nil {
-			return nil, err
+			return dst, err
 		}
 
 	default:
-		t, err = time.Parse(r.config.From, s)
+		t, err = parseTimeLayouts(r.layouts, s)
 		if err != nil {
-			return nil, err
+			return dst, err
 		}
 	}
 
+	return r.appendFormatTime(dst, t)
+}
+
+// appendFormatTime formats t into the specified destination format and appends it to dst
+func (r *Rule) appendFormatTime(dst []byte, t time.Time) (value []byte, err error) {
+
+	value = dst
 	switch r.config.To {
 
 	case "unix":
@@ -361,73 +499,89 @@ func (r *Rule) parseTime(s string) (value []byte, err error) {
 		value = strconv.AppendInt(value, t.UnixNano(), 10)
 
 	case "rfc3339":
-		value = timeAppend(t, time.RFC3339)
+		value = timeAppend(value, t, time.RFC3339)
 
 	case "rfc3339nano", "string":
-		value = timeAppend(t, time.RFC3339Nano)
+		value = timeAppend(value, t, time.RFC3339Nano)
 
 	case "iso8601":
-		value = timeAppend(t, iso8601)
+		value = timeAppend(value, t, iso8601)
 
 	case "":
 		err = errInvalidDstFormat
 
 	default:
-		value = timeAppend(t, r.config.To)
+		value = timeAppend(value, t, r.toLayout)
 	}
 
 	return value, err
 }
 
-func timeAppend(t time.Time, l string) (value []byte) {
-	value = make([]byte, 0, len(l)+2)
+func timeAppend(value []byte, t time.Time, l string) []byte {
+	// grow once for the formatted layout
+	if n := len(l) + 2; cap(value)-len(value) < n {
+		value = append(make([]byte, 0, len(value)+n), value...)
+	}
 	value = append(value, '"')
 	value = t.AppendFormat(value, l)
 	value = append(value, '"')
 	return value
 }
 
-// parseDataSize parses a digital unit string representation into a float64 in
-// bytes or any other unit format
-func (r *Rule) parseDataSize(s string) (value []byte, err error) {
+// appendDataSize parses a digital unit string representation into a float64 in
+// bytes or any other unit format and appends it to dst
+func (r *Rule) appendDataSize(dst []byte, s string) (value []byte, err error) {
 
-	match := rexUnit.FindStringSubmatch(s)
+	match := rexUnit.FindStringSubmatchIndex(s)
 	if match == nil {
-		return nil, errNoMatch
+		return dst, errNoMatch
 	}
 
-	val, err := strconv.ParseFloat(match[1], 64)
+	val, err := strconv.ParseFloat(s[match[2]:match[3]], 64)
 	if err != nil {
-		return nil, err
+		return dst, err
 	}
 
 	u := r.config.From
 	if u == "" {
-		u = strings.ToLower(match[2])
+		u = strings.ToLower(s[match[4]:match[5]])
 	}
 
 	unit, ok := dataUnits[u]
 	if !ok {
-		return nil, errInvalidSrcFormat
+		return dst, errInvalidSrcFormat
 	}
 	val = val * unit
 
 	// Convert to the specified unit
 	unit, ok = dataUnits[r.config.To]
 	if !ok {
-		return nil, errInvalidDstFormat
+		return dst, errInvalidDstFormat
 	}
 
-	value = strconv.AppendFloat(value, val/unit, 'f', -1, 64)
+	value = strconv.AppendFloat(dst, val/unit, 'f', -1, 64)
 	return value, nil
 }
 
-func jsonString(b string) (value []byte) {
+// AppendJSONString appends b as a quoted and escaped JSON string to value,
+// replacing invalid UTF-8 sequences with U+FFFD
+func AppendJSONString(value []byte, b string) []byte {
 	l := len(b)
 	value = append(value, '"')
 
 	for i := 0; i < l; i++ {
 		c := b[i]
+		if c >= utf8.RuneSelf {
+			// replace invalid utf-8 sequences with U+FFFD
+			r, size := utf8.DecodeRuneInString(b[i:])
+			if r == utf8.RuneError && size == 1 {
+				value = append(value, "\ufffd"...)
+				continue
+			}
+			value = append(value, b[i:i+size]...)
+			i += size - 1
+			continue
+		}
 		if c >= 0x20 && c != '\\' && c != '"' {
 			value = append(value, c)
 			continue
@@ -2,7 +2,11 @@ package rule
 
 import (
 	"bytes"
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -68,12 +72,45 @@ var cases = []struct {
 	{Config{Name: "time_custom_to_rfc3339", Type: Time, From: "Mon Jan 02 15:04:05 2006", To: "rfc3339",
 		Regex: `(.*)`}, []byte(`Mon Sep 21 23:09:05 2018`), []byte(`"2018-09-21T23:09:05Z"`)},
 
+	{Config{Name: "time_strftime_to_rfc3339", Type: Time, From: "%Y-%m-%d %H:%M:%S", To: "rfc3339",
+		Regex: `(.*)`}, []byte(`2018-09-21 23:09:05`), []byte(`"2018-09-21T23:09:05Z"`)},
+
+	{Config{Name: "time_layouts_to_unix", Type: Time, Layouts: []string{"%d/%m/%Y %H:%M:%S %z", time.RFC1123Z},
+		To: "unix", Regex: `(.*)`}, []byte(`Wed, 19 Sep 2018 06:46:24 +0100`), []byte(`1537335984`)},
+
+	{Config{Name: "time_rfc3339_to_strftime", Type: Time, From: "rfc3339", To: "%d/%b/%Y:%H:%M:%S %z",
+		Regex: `(.*)`}, []byte(`2018-09-19T06:46:24+01:00`), []byte(`"19/Sep/2018:06:46:24 +0100"`)},
+
+	{Config{Name: "time_auto_clf_to_unix", Type: Time, From: "auto", To: "unix",
+		Regex: `\[(.*)\]`}, []byte(`[19/Sep/2018:06:46:24 +0100]`), []byte(`1537335984`)},
+
+	{Config{Name: "time_auto_rfc1123_to_unix", Type: Time, From: "auto", To: "unix",
+		Regex: `(.*)`}, []byte(`Wed, 19 Sep 2018 05:46:24 UTC`), []byte(`1537335984`)},
+
+	{Config{Name: "time_auto_epoch_to_unix", Type: Time, From: "auto", To: "unix",
+		Regex: `(\d+)`}, []byte(`time:1537335984`), []byte(`1537335984`)},
+
+	{Config{Name: "time_auto_epoch_milli_to_unix", Type: Time, From: "auto", To: "unix",
+		Regex: `(\d+)`}, []byte(`time:1537335984123`), []byte(`1537335984`)},
+
 	// {Config{Name: "time_unix_to_rfc3339", Type: Time, From: "unix", To: "rfc3339",
 	// 	Regex: `(\d+)`}, []byte(`time:1537335984`), []byte(`"2018-09-19T06:46:24+01:00"`)},
 
 	// {Config{Name: "time_custom_to_custom", Type: Time, From: "unix", To: "Mon Jan 02 15:04:05 2006",
 	// 	Regex: `(\d+)`}, []byte(`time:1537335984`), []byte(`"Wed Sep 19 06:46:24 2018"`)},
 
+	{Config{Name: "transform_trim_lower", Type: String, Transforms: []Transform{{Op: OpTrim}, {Op: OpTrimQuotes}, {Op: OpLower}},
+		Regex: `state:(.*)`}, []byte(`state:  "RUNNING" `), []byte(`"running"`)},
+
+	{Config{Name: "transform_replace", Type: Float, Transforms: []Transform{{Op: OpReplace, Regex: `,`, With: "."}},
+		Regex: `(\S+)`}, []byte(`124,545`), []byte(`124.545`)},
+
+	{Config{Name: "transform_field", Type: Int, Transforms: []Transform{{Op: OpField, Index: 2}},
+		Regex: `^(.*)$`}, []byte(`  sda   8   0   1000`), []byte(`0`)},
+
+	{Config{Name: "transform_field_sep_last", Type: String, Transforms: []Transform{{Op: OpField, Value: ":", Index: -1}, {Op: OpUpper}},
+		Regex: `^(.*)$`}, []byte(`a:b:c`), []byte(`"C"`)},
+
 	{Config{Name: "datasize_bytes_to_kib", Type: DataSize, To: "kib",
 		Regex: `(\d+\w*)`}, []byte(`datasize:1mib`), []byte(`1024`)},
 	{Config{Name: "datasize_bytes_to_kib_explicit", Type: DataSize, From: "mib", To: "kib",
@@ -146,3 +183,278 @@ func BenchmarkTestCase(b *testing.B) {
 		})
 	}
 }
+
+func TestParseEpoch(t *testing.T) {
+	epochs := []struct {
+		data string
+		ok   bool
+		unix int64
+	}{
+		{"1537335984", true, 1537335984},
+		{"1537335984.5", true, 1537335984},
+		{"1537335984123", true, 1537335984},
+		{"1537335984123456", true, 1537335984},
+		{"1537335984123456789", true, 1537335984},
+		{"20180921", false, 0},
+		{"42", false, 0},
+		{"0000000042", false, 0},
+		{"15373359841", false, 0},
+		{"153733598.4", false, 0},
+		{"", false, 0},
+	}
+
+	for _, e := range epochs {
+		ts, ok := parseEpoch(e.data)
+		if ok != e.ok {
+			t.Fatal("not equal: ", e.data, ok, e.ok)
+		}
+
+		if ok && ts.Unix() != e.unix {
+			t.Fatal("not equal: ", e.data, ts.Unix(), e.unix)
+		}
+	}
+}
+
+func TestTimeAutoYear(t *testing.T) {
+	now := time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	yearCases := []struct {
+		data   string
+		expect string
+	}{
+		{`Jan  2 09:59:59`, `"2018-01-02T09:59:59Z"`},
+		{`Dec 31 23:59:59`, `"2017-12-31T23:59:59Z"`},
+		{`Jan  2 10:00:01`, `"2017-01-02T10:00:01Z"`},
+		{`Feb 29 12:00:00`, `"2016-02-29T12:00:00Z"`},
+	}
+
+	r, err := New(Config{Name: "time", Type: Time, From: "auto", To: "rfc3339"}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range yearCases {
+		value, ok, err := r.Parse([]byte(testCase.data))
+		if !ok || err != nil {
+			t.Fatal(testCase.data, ok, err)
+		}
+
+		if string(value) != testCase.expect {
+			t.Fatal("not equal: ", testCase.data, bytesToString(value), testCase.expect)
+		}
+	}
+}
+
+func TestRelTime(t *testing.T) {
+	now := time.Date(2018, 9, 19, 6, 46, 24, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	relCases := []struct {
+		data   string
+		expect string
+	}{
+		{`3 hours ago`, `"2018-09-19T03:46:24Z"`},
+		{`About a minute ago`, `"2018-09-19T06:45:24Z"`},
+		{`Less than a second ago`, `"2018-09-19T06:46:23Z"`},
+		{`in 2 days`, `"2018-09-21T06:46:24Z"`},
+		{`2 years, 3 months ago`, `"2016-06-19T06:46:24Z"`},
+		{`5m ago`, `"2018-09-19T06:41:24Z"`},
+		{`5ms ago`, `"2018-09-19T06:46:23Z"`},
+		{`3 secs ago`, `"2018-09-19T06:46:21Z"`},
+		{`yesterday 14:00`, `"2018-09-18T14:00:00Z"`},
+		{`tomorrow at 3 pm`, `"2018-09-20T15:00:00Z"`},
+		{`today`, `"2018-09-19T00:00:00Z"`},
+		{`just now`, `"2018-09-19T06:46:24Z"`},
+	}
+
+	r, err := New(Config{Name: "reltime", Type: RelTime, To: "rfc3339"}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range relCases {
+		value, ok, err := r.Parse([]byte(testCase.data))
+		if !ok || err != nil {
+			t.Fatal(testCase.data, ok, err)
+		}
+
+		if string(value) != testCase.expect {
+			t.Fatal("not equal: ", testCase.data, bytesToString(value), testCase.expect)
+		}
+	}
+
+	for _, invalid := range []string{`sometime soon`, `5 fortnights ago`, `99999999999999999999 seconds ago`,
+		`3000000 hours ago`, `in 9223372036854775807 ms`, `400 years ago`} {
+		if _, _, err = r.Parse([]byte(invalid)); err == nil {
+			t.Fatal("accepted invalid relative time: ", invalid)
+		}
+	}
+}
+
+func TestNewInvalidTransform(t *testing.T) {
+	transforms := [][]Transform{
+		{{Op: "reverse"}},
+		{{Op: OpReplace}},
+		{{Op: OpReplace, Regex: `(`}},
+		{{Op: OpTrimPrefix}},
+	}
+
+	for i := range transforms {
+		if _, err := New(Config{Name: "string", Type: String, Transforms: transforms[i]}); err == nil {
+			t.Fatal("accepted invalid transform: ", transforms[i])
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	literals := []struct {
+		regex   string
+		literal string
+	}{
+		{`total memory: (\d+)`, "total memory: "},
+		{`^(\w+) login from`, " login from"},
+		{`(error) code=\d+`, "error code="},
+		{`id=(\d+) user=\w+ status=(?:ok|fail)`, " status="},
+		{`(ab){2}c+`, "abab"},
+		{`(?i)total (\d+)`, ""},
+		{`(foo|bar)`, ""},
+		{`(\d+)?x`, "x"},
+		{`(.*)`, ""},
+	}
+
+	for _, l := range literals {
+		r, err := New(Config{Name: "l", Type: String, Regex: l.regex})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r.Literal() != l.literal {
+			t.Fatal("not equal: ", l.regex, r.Literal(), l.literal)
+		}
+	}
+}
+
+// scn converts hexadecimal oracle system change numbers
+type scn struct{}
+
+func (scn) Kind(config Config) Kind {
+	if config.To == "hex" {
+		return KindString
+	}
+	return KindNumber
+}
+
+func (scn) Validate(config Config) error {
+	if config.To != "" && config.To != "hex" {
+		return errors.New("invalid scn format")
+	}
+	return nil
+}
+
+func (scn) Convert(config Config, s string) ([]byte, error) {
+	u, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	if config.To == "hex" {
+		return JSONString("0x" + strconv.FormatUint(u, 16)), nil
+	}
+	return strconv.AppendUint(nil, u, 10), nil
+}
+
+// hexInt converts hexadecimal values appending to the destination,
+// its nil ConvertFunc panics if called
+type hexInt struct{ ConvertFunc }
+
+func (hexInt) AppendConvert(dst []byte, config Config, s string) ([]byte, error) {
+	u, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return dst, err
+	}
+	return strconv.AppendUint(dst, u, 10), nil
+}
+
+// unregisterTypes removes the registered types so tests can run repeatedly
+func unregisterTypes(types ...Type) {
+	convertersMtx.Lock()
+	defer convertersMtx.Unlock()
+
+	for _, t := range types {
+		delete(converters, t)
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	defer unregisterTypes("scn", "upper", "hexint")
+
+	if err := RegisterType("scn", scn{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterType("scn", scn{}); err == nil {
+		t.Fatal("accepted repeated type")
+	}
+
+	if err := RegisterType(Int, scn{}); err == nil {
+		t.Fatal("accepted builtin type")
+	}
+
+	if _, err := New(Config{Name: "scn", Type: "scn", To: "oct"}); err == nil {
+		t.Fatal("accepted invalid config")
+	}
+
+	if _, err := New(Config{Name: "unknown", Type: "unknown"}); err == nil {
+		t.Fatal("accepted unknown type")
+	}
+
+	r, err := New(Config{Name: "scn", Type: "scn", Regex: `scn: (\w+)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Kind() != KindNumber {
+		t.Fatal("invalid kind: ", r.Kind())
+	}
+
+	value, ok, err := r.Parse([]byte(`scn: 1f4a`))
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if string(value) != `8010` {
+		t.Fatal("not equal: ", bytesToString(value), `8010`)
+	}
+
+	if err = RegisterType("upper", ConvertFunc(func(config Config, s string) ([]byte, error) {
+		return JSONString(strings.ToUpper(s)), nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = New(Config{Name: "upper", Type: "upper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _, _ = r.Parse([]byte(`abc`)); string(value) != `"ABC"` {
+		t.Fatal("not equal: ", bytesToString(value), `"ABC"`)
+	}
+
+	if err = RegisterType("hexint", hexInt{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = New(Config{Name: "hexint", Type: "hexint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _, _ = r.AppendParse([]byte(`n=`), []byte(`ff`)); string(value) != `n=255` {
+		t.Fatal("not equal: ", bytesToString(value), `n=255`)
+	}
+
+	if value, _, err = r.AppendParse([]byte(`n=`), []byte(`zz`)); err == nil || string(value) != `n=` {
+		t.Fatal("not equal: ", bytesToString(value), err)
+	}
+}
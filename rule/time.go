@@ -0,0 +1,257 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const clf = "02/Jan/2006:15:04:05 -0700"
+
+var (
+	errNoTimeLayout = errors.New("no time layout, from or layouts must be specified")
+
+	// time layouts for From keywords
+	timeKeywords = map[string]string{
+		"rfc3339":     time.RFC3339,
+		"rfc3339nano": time.RFC3339Nano,
+		"iso8601":     iso8601,
+	}
+
+	// strftime(3) directives and their go layout equivalents
+	strftimeDirectives = map[byte]string{
+		'a': "Mon",
+		'A': "Monday",
+		'b': "Jan",
+		'h': "Jan",
+		'B': "January",
+		'c': "Mon Jan _2 15:04:05 2006",
+		'd': "02",
+		'e': "_2",
+		'D': "01/02/06",
+		'F': "2006-01-02",
+		'f': "000000",
+		'H': "15",
+		'I': "03",
+		'j': "002",
+		'l': "3",
+		'm': "01",
+		'M': "04",
+		'n': "\n",
+		'p': "PM",
+		'r': "03:04:05 PM",
+		'R': "15:04",
+		'S': "05",
+		't': "\t",
+		'T': "15:04:05",
+		'x': "01/02/06",
+		'X': "15:04:05",
+		'y': "06",
+		'Y': "2006",
+		'z': "-0700",
+		'Z': "MST",
+		'%': "%",
+	}
+
+	// range of auto detected epoch timestamps with 10 integer digits in seconds
+	minEpoch = time.Unix(1e9, 0)
+	maxEpoch = time.Unix(1e10, 0)
+
+	// layouts tried in order by the auto time format
+	autoLayouts = []string{
+		time.RFC3339Nano,
+		iso8601,
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05 Z0700",
+		"2006-01-02 15:04:05",
+		time.RFC1123,
+		time.RFC1123Z,
+		time.RFC850,
+		time.RFC822,
+		time.RFC822Z,
+		time.ANSIC,
+		time.UnixDate,
+		time.RubyDate,
+		clf,
+		time.Stamp,
+		"2006-01-02",
+	}
+)
+
+// timeLayouts returns the go time layouts to parse from and format to
+// for the given config. strftime formats are converted to go layouts.
+func timeLayouts(config Config) (from []string, to string, err error) {
+
+	switch config.From {
+	case "unix", "unix_nano", "unix_milli", "auto":
+	case "":
+		if len(config.Layouts) == 0 {
+			return nil, "", errNoTimeLayout
+		}
+	default:
+		l, err := timeLayout(config.From)
+		if err != nil {
+			return nil, "", err
+		}
+		from = append(from, l)
+	}
+
+	for i := range config.Layouts {
+		l, err := timeLayout(config.Layouts[i])
+		if err != nil {
+			return nil, "", err
+		}
+		from = append(from, l)
+	}
+
+	if to, err = timeLayout(config.To); err != nil {
+		return nil, "", err
+	}
+
+	return from, to, nil
+}
+
+// timeLayout returns the go time layout for a keyword, strftime format or go layout
+func timeLayout(f string) (layout string, err error) {
+	if l, ok := timeKeywords[f]; ok {
+		return l, nil
+	}
+
+	if strings.IndexByte(f, '%') > -1 {
+		return strftime(f)
+	}
+
+	return f, nil
+}
+
+// strftime converts a strftime(3) format into a go time layout
+func strftime(f string) (layout string, err error) {
+	l := make([]byte, 0, len(f)+8)
+
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			l = append(l, f[i])
+			continue
+		}
+
+		i++
+		if i == len(f) {
+			return "", fmt.Errorf("invalid strftime format %q", f)
+		}
+
+		d, ok := strftimeDirectives[f[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported strftime directive %%%c in %q", f[i], f)
+		}
+		l = append(l, d...)
+	}
+
+	return string(l), nil
+}
+
+// parseTimeLayouts parses s with the first matching layout
+func parseTimeLayouts(layouts []string, s string) (t time.Time, err error) {
+	err = errInvalidSrcFormat
+	for i := range layouts {
+		if t, err = time.Parse(layouts[i], s); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// parseTimeAuto parses s with the configured layouts, epoch timestamps
+// in seconds, milliseconds, microseconds or nanoseconds by magnitude,
+// and a set of common time formats
+func (r *Rule) parseTimeAuto(s string) (t time.Time, err error) {
+
+	if t, err = parseTimeLayouts(r.layouts, s); err == nil {
+		return t, nil
+	}
+
+	if t, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+
+	for i := range autoLayouts {
+		if t, err = time.Parse(autoLayouts[i], s); err == nil {
+			// syslog timestamps have no year
+			if t.Year() == 0 {
+				t = lastYear(t, r.now())
+			}
+			return t, nil
+		}
+	}
+
+	return t, errInvalidSrcFormat
+}
+
+// lastYear sets the year of a time parsed without a year to the latest year
+// where its date exists and it's not after now
+func lastYear(t, now time.Time) time.Time {
+	for year := now.Year(); ; year-- {
+		d := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if d.Day() == t.Day() && !d.After(now) {
+			return d
+		}
+	}
+}
+
+// parseEpoch parses an epoch timestamp in seconds, milliseconds, microseconds or
+// nanoseconds by its number of integer digits. Only the digit counts of times since
+// 2001-09-09 are accepted to not mistake compact dates and short numbers for epochs.
+func parseEpoch(s string) (t time.Time, ok bool) {
+	digits := strings.IndexByte(s, '.')
+	if digits < 0 {
+		digits = len(s)
+	}
+
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && i != digits {
+			return t, false
+		}
+	}
+
+	if digits < len(s) {
+		if digits != 10 {
+			return t, false
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return t, false
+		}
+		sec := int64(f)
+		t = time.Unix(sec, int64((f-float64(sec))*1e9))
+		return t, validEpoch(t)
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return t, false
+	}
+
+	switch digits {
+	case 10:
+		t = time.Unix(i, 0)
+	case 13:
+		t = time.Unix(0, i*int64(time.Millisecond))
+	case 16:
+		t = time.Unix(0, i*int64(time.Microsecond))
+	case 19:
+		t = time.Unix(0, i)
+	default:
+		return t, false
+	}
+
+	return t, validEpoch(t)
+}
+
+// validEpoch checks the range of auto detected epoch timestamps,
+// rejecting values with leading zeros
+func validEpoch(t time.Time) (ok bool) {
+	return !t.Before(minEpoch) && t.Before(maxEpoch)
+}
@@ -0,0 +1,175 @@
+package rule
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Op is a transform operation
+type Op string
+
+// Transform operations
+const (
+	OpTrim       Op = "trim"        // trim the value cutset or whitespace from both ends
+	OpTrimPrefix Op = "trim_prefix" // trim the value prefix
+	OpTrimSuffix Op = "trim_suffix" // trim the value suffix
+	OpTrimQuotes Op = "trim_quotes" // strip matching surrounding ' " or ` quotes
+	OpLower      Op = "lower"       // lower case
+	OpUpper      Op = "upper"       // upper case
+	OpReplace    Op = "replace"     // replace regex matches with the with template
+	OpField      Op = "field"       // take the field at index split by value or whitespace
+)
+
+var (
+	errInvalidTransform = errors.New("invalid transform operation")
+	errTransformValue   = errors.New("transform value required")
+	errTransformRegex   = errors.New("transform regex required")
+)
+
+// Transform config for a string transformation applied to the extracted data before parsing
+type Transform struct {
+	Op    Op     `json:"op"`    // Transform operation
+	Value string `json:"value"` // Cutset for trim, prefix/suffix for trim_prefix/trim_suffix or separator for field
+	Regex string `json:"regex"` // Regexp for replace
+	With  string `json:"with"`  // Replacement template for replace
+	Index int    `json:"index"` // Field index for field, negative values count from the end
+}
+
+type transform struct {
+	regex  *regexp.Regexp
+	config Transform
+}
+
+// newTransforms validates and compiles the given transforms
+func newTransforms(config []Transform) (transforms []transform, err error) {
+	for i := range config {
+		t := transform{config: config[i]}
+
+		switch config[i].Op {
+		case OpTrim, OpTrimQuotes, OpLower, OpUpper, OpField:
+
+		case OpTrimPrefix, OpTrimSuffix:
+			if config[i].Value == "" {
+				return nil, errTransformValue
+			}
+
+		case OpReplace:
+			if config[i].Regex == "" {
+				return nil, errTransformRegex
+			}
+			if t.regex, err = regexp.Compile(config[i].Regex); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, errInvalidTransform
+		}
+
+		transforms = append(transforms, t)
+	}
+
+	return transforms, nil
+}
+
+// apply the transform to s. Except for case changes and replacements
+// the result is a substring of s and no allocations are made
+func (t *transform) apply(s string) string {
+	switch t.config.Op {
+	case OpTrim:
+		if t.config.Value == "" {
+			return strings.TrimSpace(s)
+		}
+		return strings.Trim(s, t.config.Value)
+
+	case OpTrimPrefix:
+		return strings.TrimPrefix(s, t.config.Value)
+
+	case OpTrimSuffix:
+		return strings.TrimSuffix(s, t.config.Value)
+
+	case OpTrimQuotes:
+		if l := len(s); l > 1 && s[0] == s[l-1] && (s[0] == '"' || s[0] == '\'' || s[0] == '`') {
+			return s[1 : l-1]
+		}
+		return s
+
+	case OpLower:
+		return strings.ToLower(s)
+
+	case OpUpper:
+		return strings.ToUpper(s)
+
+	case OpReplace:
+		if !t.regex.MatchString(s) {
+			return s
+		}
+		return t.regex.ReplaceAllString(s, t.config.With)
+
+	case OpField:
+		return field(s, t.config.Value, t.config.Index)
+	}
+
+	return s
+}
+
+// field returns the field n of s split by sep or by whitespace if sep is empty.
+// A negative n counts from the last field. Returns an empty string if out of range.
+func field(s, sep string, n int) string {
+	if sep == "" {
+		return spaceField(s, n)
+	}
+
+	c := strings.Count(s, sep) + 1
+	if n < 0 {
+		n = c + n
+	}
+	if n < 0 || n >= c {
+		return ""
+	}
+
+	for ; n > 0; n-- {
+		s = s[strings.Index(s, sep)+len(sep):]
+	}
+	if i := strings.Index(s, sep); i > -1 {
+		s = s[:i]
+	}
+	return s
+}
+
+// spaceField returns the whitespace separated field n of s
+func spaceField(s string, n int) string {
+	if n < 0 {
+		c := 0
+		for _, rest, ok := nextSpaceField(s); ok; _, rest, ok = nextSpaceField(rest) {
+			c++
+		}
+		n = c + n
+		if n < 0 {
+			return ""
+		}
+	}
+
+	for f, rest, ok := nextSpaceField(s); ok; f, rest, ok = nextSpaceField(rest) {
+		if n == 0 {
+			return f
+		}
+		n--
+	}
+
+	return ""
+}
+
+// nextSpaceField returns the first whitespace separated field in s and the remaining input.
+// ok is false when there are no more fields.
+func nextSpaceField(s string) (f, rest string, ok bool) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if s == "" {
+		return "", "", false
+	}
+	if i := strings.IndexFunc(s, unicode.IsSpace); i > -1 {
+		return s[:i], s[i:], true
+	}
+	return s, "", true
+}
@@ -0,0 +1,283 @@
+package rxde
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	errLongLine       = errors.New("line exceeds max_line_bytes")
+	errLongLinePolicy = errors.New("invalid long_lines policy")
+)
+
+// LongLines is the policy for lines longer than Config.MaxLineBytes
+type LongLines string
+
+// Long line policies. Without a policy parsing ends with an error on the first long line.
+const (
+	LongLinesTruncate LongLines = "truncate" // truncate the line to max_line_bytes
+	LongLinesSkip     LongLines = "skip"     // skip the line adding an error to the next result
+	LongLinesSplit    LongLines = "split"    // split the line into lines of up to max_line_bytes
+)
+
+// validLongLines checks the long line policy
+func validLongLines(l LongLines) (err error) {
+	switch l {
+	case "", LongLinesTruncate, LongLinesSkip, LongLinesSplit:
+		return nil
+	}
+	return errLongLinePolicy
+}
+
+// waiter is implemented by sources signaling when they wait for new data
+type waiter interface {
+	waiting() (wait <-chan struct{})
+}
+
+// lineScanner scans lines keeping track of line numbers and byte offsets
+type lineScanner struct {
+	*bufio.Scanner
+	line     int64 // current line number starting at 1
+	offset   int64 // byte offset of the current line
+	consumed int64 // bytes consumed by the split function
+	max      int   // maximum line length
+	policy   LongLines
+	splitter *splitter
+	discard  bool    // discarding the remainder of a long line
+	fragment bool    // the last token is a long line fragment without its terminator
+	cont     bool    // the current line continues the line of the previous token
+	skipped  int     // long lines skipped by the split function before the current token
+	errors   []error // skipped long lines
+
+	// idle detection and cancellation, lines are scanned by a feeder
+	// goroutine that waits for an ack before scanning the next line
+	timeout time.Duration
+	wait    <-chan struct{} // source signals when waiting for new data
+	ctx     context.Context
+	cancel  <-chan struct{} // parse context done
+	ctxErr  error           // parse context error once cancelled
+	idle    bool            // the input was idle for the timeout, there is no current line
+	waiting bool            // the feeder is scanning the next line
+	tokens  chan int        // feeder scanned lines with their skipped lines, closed at the end of the input
+	ack     chan struct{}
+	done    chan struct{}
+}
+
+func newLineScanner(ctx context.Context, r io.Reader, sp *splitter, config *Config) (s *lineScanner) {
+	s = &lineScanner{
+		Scanner:  bufio.NewScanner(r),
+		max:      config.MaxLineBytes,
+		policy:   config.LongLines,
+		splitter: sp,
+		timeout:  time.Duration(config.FlushIdle),
+		ctx:      ctx,
+		cancel:   ctx.Done(),
+	}
+	if s.max <= 0 {
+		s.max = bufio.MaxScanTokenSize
+	}
+	// room for the longest line and its terminator
+	s.Buffer(make([]byte, 0, 4096), s.max+sp.maxSep())
+	s.Split(s.split)
+	return s
+}
+
+// split splits lines with the splitter tracking offsets and handling long lines.
+// Tokens always start at the beginning of the data.
+func (s *lineScanner) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if s.discard {
+		var done bool
+		advance, done = s.splitter.discard(data, atEOF)
+		s.discard = !done
+		s.consumed += int64(advance)
+		return advance, nil, nil
+	}
+
+	advance, token = s.splitter.split(data, atEOF)
+	s.fragment = false
+
+	switch {
+	case token != nil && len(token) > s.max:
+		advance, token, err = s.long(data, advance, token)
+	case token == nil && advance == 0 && len(data) >= s.max+s.splitter.maxSep():
+		// the line does not fit in the buffer
+		advance, token, err = s.long(data, 0, data)
+	}
+
+	if token != nil {
+		s.offset = s.consumed
+	}
+	s.consumed += int64(advance)
+	return advance, token, err
+}
+
+// long applies the long line policy to the line token. An advance of zero
+// means the line end is not in data and its remainder must be discarded.
+func (s *lineScanner) long(data []byte, advance int, token []byte) (adv int, tok []byte, err error) {
+	if s.policy == LongLinesSplit {
+		s.fragment = true
+		return s.max, data[:s.max], nil
+	}
+
+	if advance == 0 {
+		advance = len(data)
+		s.discard = true
+	}
+
+	switch s.policy {
+	case LongLinesTruncate:
+		return advance, token[:s.max], nil
+	case LongLinesSkip:
+		// counted with the next token as the split function may run in the feeder
+		s.skipped++
+		return advance, nil, nil
+	}
+
+	return 0, nil, bufio.ErrTooLong
+}
+
+// Scan advances to the next line, returning false when the parse context is done.
+// With an idle timeout or a waiting source it returns true with idle set when no line
+// is scanned within the timeout or the source waits for new data. Lines are scanned
+// by the feeder when the context can be cancelled, abandoning a blocked read on cancellation.
+func (s *lineScanner) Scan() (ok bool) {
+	if s.cancelled() {
+		return false
+	}
+
+	if s.timeout <= 0 && s.wait == nil && s.cancel == nil {
+		ok = s.Scanner.Scan()
+		s.count(s.skipped, ok)
+		s.skipped = 0
+		if ok {
+			return true
+		}
+		// the read may have failed from closing the reader on cancellation
+		s.cancelled()
+		return false
+	}
+
+	s.idle = false
+	if !s.waiting {
+		if s.tokens == nil {
+			s.tokens = make(chan int)
+			s.ack = make(chan struct{})
+			s.done = make(chan struct{})
+			go s.feed()
+		} else {
+			s.ack <- struct{}{}
+		}
+		s.waiting = true
+	}
+
+	var timeout <-chan time.Time
+	if s.timeout > 0 {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var skipped int
+	select {
+	case skipped, ok = <-s.tokens:
+		s.waiting = false
+		if !ok {
+			// the feeder is done, count the lines skipped at the end of the input
+			skipped = s.skipped
+			s.cancelled()
+		}
+		s.count(skipped, ok)
+		// the source signaled waiting before this line was read
+		select {
+		case <-s.wait:
+		default:
+		}
+		return ok
+	case <-timeout:
+		s.idle = true
+		return true
+	case <-s.wait:
+		s.idle = true
+		return true
+	case <-s.cancel:
+		s.ctxErr = s.ctx.Err()
+		return false
+	}
+}
+
+// count counts the skipped long lines adding their errors, and the line of
+// the scanned token once for all fragments of a split line
+func (s *lineScanner) count(skipped int, token bool) {
+	for ; skipped > 0; skipped-- {
+		s.line++
+		s.errors = append(s.errors, fmt.Errorf("line %d: %w", s.line, errLongLine))
+	}
+
+	if !token {
+		return
+	}
+
+	if !s.cont {
+		s.line++
+	}
+	s.cont = s.fragment
+}
+
+// cancelled checks if the parse context is done recording its error
+func (s *lineScanner) cancelled() bool {
+	select {
+	case <-s.cancel:
+		s.ctxErr = s.ctx.Err()
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns the scanner error, nil while the feeder is scanning
+func (s *lineScanner) Err() (err error) {
+	if s.waiting {
+		return nil
+	}
+	return s.Scanner.Err()
+}
+
+// pending returns and clears the skipped long line errors
+func (s *lineScanner) pending() (errs []error) {
+	errs, s.errors = s.errors, nil
+	return errs
+}
+
+// feed scans lines until the end of the input or close, waiting
+// for an ack after each line so its token stays valid
+func (s *lineScanner) feed() {
+	defer close(s.tokens)
+
+	for s.Scanner.Scan() {
+		skipped := s.skipped
+		s.skipped = 0
+
+		select {
+		case s.tokens <- skipped:
+		case <-s.done:
+			return
+		}
+
+		select {
+		case <-s.ack:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close stops the feeder, which exits after its current read
+func (s *lineScanner) close() {
+	if s.done != nil {
+		close(s.done)
+	}
+}
@@ -0,0 +1,135 @@
+package rxde
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+)
+
+var (
+	errSplit     = errors.New("invalid split")
+	errSeparator = errors.New("empty separator or separator matching empty input")
+)
+
+// Split is the terminator used for splitting the input into lines
+type Split string
+
+// Input splits. Without a split lines are terminated by a newline.
+const (
+	SplitNewline Split = "newline" // "\n" with an optional preceding "\r"
+	SplitCRLF    Split = "crlf"    // "\r\n" only
+	SplitCR      Split = "cr"      // "\r" only
+	SplitNUL     Split = "nul"     // "\x00"
+	SplitBytes   Split = "bytes"   // the separator byte sequence
+	SplitRegex   Split = "regex"   // matches of the separator regex
+)
+
+// splitter finds line terminators in the input
+type splitter struct {
+	kind  Split
+	sep   []byte
+	regex *regexp.Regexp
+}
+
+// compileSplit creates the splitter for the split kind and separator
+func compileSplit(kind Split, separator string) (sp splitter, err error) {
+	sp.kind = kind
+
+	switch kind {
+	case "", SplitNewline:
+		sp.kind = SplitNewline
+		sp.sep = []byte{'\n'}
+	case SplitCRLF:
+		sp.sep = []byte{'\r', '\n'}
+	case SplitCR:
+		sp.sep = []byte{'\r'}
+	case SplitNUL:
+		sp.sep = []byte{0}
+	case SplitBytes:
+		if separator == "" {
+			return sp, errSeparator
+		}
+		sp.sep = []byte(separator)
+	case SplitRegex:
+		if sp.regex, err = regexp.Compile(separator); err != nil {
+			return sp, err
+		}
+		if sp.regex.MatchString("") {
+			return sp, errSeparator
+		}
+	default:
+		return sp, errSplit
+	}
+
+	return sp, nil
+}
+
+// maxSep returns the length of the longest terminator known in advance
+func (sp *splitter) maxSep() (n int) {
+	switch sp.kind {
+	case SplitNewline:
+		return 2
+	case SplitRegex:
+		return 1
+	}
+	return len(sp.sep)
+}
+
+// index returns the index and length of the first terminator in data, or -1.
+// A regex match ending at the end of data is not final unless atEOF.
+func (sp *splitter) index(data []byte, atEOF bool) (i, n int) {
+	if sp.regex != nil {
+		loc := sp.regex.FindIndex(data)
+		if loc == nil || (loc[1] == len(data) && !atEOF) {
+			return -1, 0
+		}
+		return loc[0], loc[1] - loc[0]
+	}
+
+	if i = bytes.Index(data, sp.sep); i < 0 {
+		return -1, 0
+	}
+	return i, len(sp.sep)
+}
+
+// split returns the next line in data, dropping a trailing "\r" in newline mode
+func (sp *splitter) split(data []byte, atEOF bool) (advance int, token []byte) {
+	if atEOF && len(data) == 0 {
+		return 0, nil
+	}
+
+	if i, n := sp.index(data, atEOF); i >= 0 {
+		return i + n, sp.dropCR(data[:i])
+	}
+
+	if atEOF {
+		return len(data), sp.dropCR(data)
+	}
+
+	return 0, nil
+}
+
+// discard returns how much of data to skip for discarding the remainder of a line,
+// and true if the line terminator was found
+func (sp *splitter) discard(data []byte, atEOF bool) (advance int, done bool) {
+	if i, n := sp.index(data, atEOF); i >= 0 {
+		return i + n, true
+	}
+
+	if atEOF || sp.regex != nil {
+		return len(data), false
+	}
+
+	// keep a possibly partial terminator
+	if advance = len(data) - len(sp.sep) + 1; advance < 0 {
+		advance = 0
+	}
+	return advance, false
+}
+
+func (sp *splitter) dropCR(line []byte) []byte {
+	if sp.kind == SplitNewline && len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
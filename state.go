@@ -0,0 +1,220 @@
+package rxde
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/brunotm/rxde/rule"
+)
+
+var (
+	errStateName  = errors.New("empty or repeated state name")
+	errStateEnter = errors.New("empty state enter")
+	errStateMode  = errors.New("states are not supported with regex or multiline")
+)
+
+// State of the section state machine. A state is entered from its parent when its
+// enter regex matches, starting a new record scoped to the section, and is left
+// when its exit regex, the exit of an enclosing state or the enter of a sibling or
+// enclosing state sibling matches. The top level rules belong to the implicit root
+// state and records inherit the values of the records of their enclosing states.
+type State struct {
+	Name   string        `json:"name"`   // state name
+	Enter  string        `json:"enter"`  // enter this state when matched (inclusive current line)
+	Exit   string        `json:"exit"`   // leave this state when matched (exclusive current line)
+	Rules  []rule.Config `json:"rules"`  // rules for parse and extract data in this state
+	States []State       `json:"states"` // nested states
+}
+
+type state struct {
+	path     string // state names from the root joined by "."
+	enter    *regexp.Regexp
+	exit     *regexp.Regexp
+	rules    []int // parser rule indexes
+	children []*state
+}
+
+// frame of the state machine stack
+type frame struct {
+	state *state
+	rec   *record
+}
+
+// compileStates creates the root state with the top level rules, and
+// the nested states appending their rules to the parser rules.
+func (p *Parser) compileStates(config []State, names map[string]struct{}) (err error) {
+	if len(config) == 0 {
+		return nil
+	}
+
+	if p.regex != nil || p.multiline != nil {
+		return errStateMode
+	}
+
+	p.root = &state{}
+	for i := range p.rules {
+		p.root.rules = append(p.root.rules, i)
+	}
+
+	return p.compileChildren(p.root, config, names)
+}
+
+func (p *Parser) compileChildren(parent *state, config []State, names map[string]struct{}) (err error) {
+	siblings := make(map[string]struct{}, len(config))
+
+	for i := range config {
+		if _, ok := siblings[config[i].Name]; ok || config[i].Name == "" {
+			return errStateName
+		}
+		siblings[config[i].Name] = struct{}{}
+
+		if config[i].Enter == "" {
+			return errStateEnter
+		}
+
+		st := &state{path: config[i].Name}
+		if parent.path != "" {
+			st.path = parent.path + "." + config[i].Name
+		}
+
+		if st.enter, err = regexp.Compile(config[i].Enter); err != nil {
+			return err
+		}
+
+		if config[i].Exit != "" {
+			if st.exit, err = regexp.Compile(config[i].Exit); err != nil {
+				return err
+			}
+		}
+
+		for r := range config[i].Rules {
+			if _, ok := names[config[i].Rules[r].Name]; ok {
+				return errRepeatedRuleName
+			}
+			names[config[i].Rules[r].Name] = struct{}{}
+
+			ru, err := rule.New(config[i].Rules[r], rule.WithClock(p.clock))
+			if err != nil {
+				return err
+			}
+			st.rules = append(st.rules, len(p.rules))
+			p.rules = append(p.rules, ru)
+		}
+
+		if err = p.compileChildren(st, config[i].States, names); err != nil {
+			return err
+		}
+
+		parent.children = append(parent.children, st)
+	}
+
+	return nil
+}
+
+// push enters the state starting a record that inherits the values of the current top record
+func (p *Parser) push(stack []frame, st *state, s *session) []frame {
+	rec := p.newRecord(s)
+	if len(stack) > 0 {
+		top := stack[len(stack)-1].rec
+		copy(rec.values, top.values)
+		copy(rec.matched, top.matched)
+		rec.Data = append(rec.Data, top.Data...)
+	}
+	return append(stack, frame{state: st, rec: rec})
+}
+
+// pop leaves the states above depth emitting their records
+func (p *Parser) pop(stack []frame, depth int, s *session) (newStack []frame, ok bool) {
+	for len(stack) > depth {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !f.rec.empty() {
+			if p.config.StateField != "" {
+				f.rec.Data = appendJSON(f.rec.Data, p.config.StateField, rule.AppendJSONString(nil, f.state.path))
+			}
+			if !p.flush(f.rec, s) {
+				return stack, false
+			}
+		}
+	}
+	return stack, true
+}
+
+func (p *Parser) parseStates(s *session) {
+
+	var skip int
+	var ok bool
+	scanner := s.scanner
+	stack := p.push(make([]frame, 0, 8), p.root, s)
+
+scan:
+	for scanner.Scan() {
+		// Section records stay open while the input is idle
+		if scanner.idle {
+			continue
+		}
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		if p.stop(s, line) {
+			break
+		}
+
+		if p.skip(&skip, line) {
+			continue
+		}
+
+		p.updateSticky(s, line)
+
+		// Leave the innermost state whose exit matches with its nested states
+		for depth := len(stack) - 1; depth > 0; depth-- {
+			if x := stack[depth].state.exit; x != nil && x.Match(line) {
+				if stack, ok = p.pop(stack, depth, s); !ok {
+					return
+				}
+				continue scan
+			}
+		}
+
+		// Enter the state whose enter matches in the innermost enclosing state
+	enter:
+		for depth := len(stack) - 1; depth >= 0; depth-- {
+			for _, child := range stack[depth].state.children {
+				if child.enter.Match(line) {
+					if stack, ok = p.pop(stack, depth+1, s); !ok {
+						return
+					}
+					stack = p.push(stack, child, s)
+					break enter
+				}
+			}
+		}
+
+		top := stack[len(stack)-1]
+		top.rec.touch(s)
+
+		for _, r := range top.state.rules {
+			if top.rec.has(r) {
+				continue
+			}
+
+			value, ok, err := top.rec.parse(p.rules[r], line)
+			if err != nil {
+				top.rec.Errors = append(top.rec.Errors, err)
+				continue
+			}
+
+			if ok {
+				top.rec.set(r, p.rules[r].Config().Name, value)
+			}
+		}
+	}
+
+	if _, ok = p.pop(stack, 0, s); ok {
+		p.done(s)
+	}
+}
@@ -0,0 +1,36 @@
+package rxde
+
+// updateSticky evaluates the sticky rules against the line, remembering
+// matched values for the records started from this line on
+func (p *Parser) updateSticky(s *session, line []byte) {
+	for i := range p.sticky {
+		value, ok, err := p.sticky[i].Parse(line)
+		if err != nil {
+			s.errors = append(s.errors, err)
+			continue
+		}
+
+		if ok && value != nil {
+			s.sticky[i] = value
+		}
+	}
+}
+
+// injectSticky adds the sticky values taken when the record started
+// and pending sticky and skipped line errors to the record
+func (p *Parser) injectSticky(rec *record, s *session) {
+	for i := range p.sticky {
+		if value := rec.values[len(p.rules)+i]; value != nil {
+			rec.Data = appendJSON(rec.Data, p.sticky[i].Config().Name, value)
+		}
+	}
+
+	if s.errors != nil {
+		rec.Errors = append(rec.Errors, s.errors...)
+		s.errors = nil
+	}
+
+	if errs := s.scanner.pending(); errs != nil {
+		rec.Errors = append(rec.Errors, errs...)
+	}
+}